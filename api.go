@@ -0,0 +1,357 @@
+package quotes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiMaxBody limits the size of json request bodies.
+const apiMaxBody = 64 * 1024
+
+// apiDateLayout is how dates are given in query parameters.
+const apiDateLayout = "2006-01-02"
+
+// Codes of the errors returned by the json api.
+const (
+	apiCodeBadRequest       = "bad_request"
+	apiCodeForbidden        = "forbidden"
+	apiCodeMethodNotAllowed = "method_not_allowed"
+	apiCodeQuoteNotFound    = "quote_not_found"
+	apiCodeNoQuotes         = "no_quotes"
+	apiCodeDuplicate        = "duplicate"
+	apiCodeQuoteLocked      = "quote_locked"
+	apiCodeRateLimited      = "rate_limited"
+	apiCodeInternal         = "internal_error"
+)
+
+// apiErrors maps the package's errors to their status and code, errors not
+// found here are internal errors.
+var apiErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrQuoteNotFound, http.StatusNotFound, apiCodeQuoteNotFound},
+	{ErrNoQuotes, http.StatusNotFound, apiCodeNoQuotes},
+	{ErrDuplicate, http.StatusConflict, apiCodeDuplicate},
+	{ErrQuoteLocked, http.StatusConflict, apiCodeQuoteLocked},
+	{ErrRateLimited, http.StatusTooManyRequests, apiCodeRateLimited},
+	{ErrInvalidQuote, http.StatusBadRequest, apiCodeBadRequest},
+	{ErrRejectedContent, http.StatusBadRequest, apiCodeBadRequest},
+}
+
+// errorResponse is the body of every json api error.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// searchResponse is the body of /api/search
+type searchResponse struct {
+	Quotes  []Quote `json:"quotes"`
+	Total   int     `json:"total"`
+	Page    int     `json:"page"`
+	PerPage int     `json:"per_page"`
+}
+
+// apiSearch serves /api/search?q=&tag=&author=&page=&per_page=&sort=&all=
+func (q *QuoteDB) apiSearch(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	opts := SearchOptions{
+		Text:      query.Get("q"),
+		Tag:       query.Get("tag"),
+		Author:    query.Get("author"),
+		FilterLow: !queryBool(query, "all"),
+		Sort:      query.Get("sort"),
+	}
+	if _, ok := searchOrders[opts.Sort]; len(opts.Sort) != 0 && !ok {
+		q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "unknown sort: "+opts.Sort)
+		return
+	}
+
+	opts.Page = queryInt(query, "page", 1, searchMaxPage)
+	opts.PerPage = queryInt(query, "per_page", searchDefaultPerPage, searchMaxPerPage)
+
+	quotes, total, err := q.Search(opts)
+	if err != nil {
+		q.apiFailure(w, r, "Failed to search", err)
+		return
+	}
+
+	q.writeJSON(w, r, http.StatusOK, searchResponse{
+		Quotes:  quotes,
+		Total:   total,
+		Page:    opts.Page,
+		PerPage: opts.PerPage,
+	})
+}
+
+// apiRandom serves /api/random with a random quote, see RandomQuote.
+func (q *QuoteDB) apiRandom(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	quote, err := q.RandomQuote()
+	if err == sql.ErrNoRows {
+		err = ErrNoQuotes
+	}
+	if err != nil {
+		q.apiFailure(w, r, "Failed to get random quote", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	q.writeJSON(w, r, http.StatusOK, quote)
+}
+
+// quotesResponse is the body of /api/quotes, Next is the before to pass to
+// get the next page or 0 if this was the last one.
+type quotesResponse struct {
+	Quotes []Quote `json:"quotes"`
+	Next   int     `json:"next"`
+}
+
+// apiQuotes serves /api/quotes?before=&limit=&all= which pages through the
+// quotes newest first, see GetBefore.
+func (q *QuoteDB) apiQuotes(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	before := 0
+	if b := query.Get("before"); len(b) != 0 {
+		var err error
+		if before, err = strconv.Atoi(b); err != nil || before < 0 {
+			q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "before must be a quote id")
+			return
+		}
+	}
+
+	limit := queryInt(query, "limit", searchDefaultPerPage, searchMaxPerPage)
+	quotes, err := q.GetBefore(before, limit, !queryBool(query, "all"))
+	if err != nil {
+		q.apiFailure(w, r, "Failed to get quotes", err)
+		return
+	}
+
+	resp := quotesResponse{Quotes: quotes}
+	if len(quotes) == limit {
+		resp.Next = quotes[len(quotes)-1].ID
+	}
+
+	q.writeJSON(w, r, http.StatusOK, resp)
+}
+
+// timeseriesMaxDays limits how long a series /api/stats/timeseries returns.
+const timeseriesMaxDays = 3660
+
+// timeseriesResponse is the body of /api/stats/timeseries
+type timeseriesResponse struct {
+	Days []DayCount `json:"days"`
+}
+
+// apiTimeseries serves /api/stats/timeseries?start=&end= with the number of
+// quotes added per day, see QuotesPerDay. start and end are dates like
+// 2006-01-02, the series defaults to the last 30 days.
+func (q *QuoteDB) apiTimeseries(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	end := time.Now().UTC()
+	if e := query.Get("end"); len(e) != 0 {
+		var err error
+		if end, err = time.Parse(apiDateLayout, e); err != nil {
+			q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "end must be a date like "+apiDateLayout)
+			return
+		}
+	}
+	start := end.AddDate(0, 0, -29)
+	if s := query.Get("start"); len(s) != 0 {
+		var err error
+		if start, err = time.Parse(apiDateLayout, s); err != nil {
+			q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "start must be a date like "+apiDateLayout)
+			return
+		}
+	}
+
+	if end.Before(start) {
+		q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "end must not be before start")
+		return
+	}
+	if end.Sub(start) >= timeseriesMaxDays*24*time.Hour {
+		q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest,
+			"series must not be longer than "+strconv.Itoa(timeseriesMaxDays)+" days")
+		return
+	}
+
+	days, err := q.QuotesPerDay(start, end)
+	if err != nil {
+		q.apiFailure(w, r, "Failed to count quotes per day", err)
+		return
+	}
+
+	q.writeJSON(w, r, http.StatusOK, timeseriesResponse{Days: days})
+}
+
+// editRequest is the body of PUT /api/quotes/{id}, an empty author leaves
+// the author as it is.
+type editRequest struct {
+	Quote  string `json:"quote"`
+	Author string `json:"author"`
+}
+
+// deleteResponse is the body of DELETE /api/quotes/{id}
+type deleteResponse struct {
+	ID      int  `json:"id"`
+	Deleted bool `json:"deleted"`
+}
+
+// apiQuote serves GET /api/quotes/{id}?voter= and the admin endpoints
+// DELETE and PUT /api/quotes/{id}. The admin endpoints always require basic
+// auth, when it's not configured they're forbidden rather than open to
+// anyone.
+func (q *QuoteDB) apiQuote(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete, http.MethodPut:
+		if !q.webauth {
+			q.apiError(w, r, http.StatusForbidden, apiCodeForbidden, "admin api requires web auth")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE, PUT")
+		q.apiError(w, r, http.StatusMethodNotAllowed, apiCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/quotes/"))
+	if err != nil {
+		q.apiError(w, r, http.StatusNotFound, apiCodeQuoteNotFound, ErrQuoteNotFound.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		q.apiDelete(w, r, id)
+	case http.MethodPut:
+		q.apiEdit(w, r, id)
+	default:
+		q.apiGet(w, r, id)
+	}
+}
+
+// apiGet responds with a quote and the vote of the voter named by the voter
+// query parameter on it, my_vote is 0 when there's no voter.
+func (q *QuoteDB) apiGet(w http.ResponseWriter, r *http.Request, id int) {
+	view, err := q.GetQuoteFor(id, r.URL.Query().Get("voter"))
+	if err != nil {
+		q.apiFailure(w, r, "Failed to get quote", err)
+		return
+	}
+
+	q.writeJSON(w, r, http.StatusOK, view)
+}
+
+// apiDelete deletes a quote with DelQuote.
+func (q *QuoteDB) apiDelete(w http.ResponseWriter, r *http.Request, id int) {
+	deleted, err := q.DelQuote(id)
+	if err != nil {
+		q.apiFailure(w, r, "Failed to delete quote", err)
+		return
+	}
+	if !deleted {
+		q.apiFailure(w, r, "Failed to delete quote", ErrQuoteNotFound)
+		return
+	}
+
+	q.writeJSON(w, r, http.StatusOK, deleteResponse{ID: id, Deleted: true})
+}
+
+// apiEdit edits a quote with EditQuoteFull, the authenticated user is
+// recorded as the editor. It responds with the quote as it is after the edit.
+func (q *QuoteDB) apiEdit(w http.ResponseWriter, r *http.Request, id int) {
+	var req editRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBody)).Decode(&req); err != nil {
+		q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "body must be a json object")
+		return
+	}
+	if len(strings.TrimSpace(req.Quote)) == 0 {
+		q.apiError(w, r, http.StatusBadRequest, apiCodeBadRequest, "quote must not be empty")
+		return
+	}
+
+	editor := q.authUser(r)
+	var err error
+	if len(req.Author) == 0 {
+		_, err = q.EditQuote(id, req.Quote, editor)
+	} else {
+		_, err = q.EditQuoteFull(id, req.Author, req.Quote, editor)
+	}
+	if err != nil {
+		q.apiFailure(w, r, "Failed to edit quote", err)
+		return
+	}
+
+	// The edit may have been to a quote that's still waiting for moderation,
+	// which GetQuote wouldn't find.
+	quote, err := q.getQuoteAnyStatus(id)
+	if err == sql.ErrNoRows {
+		err = ErrQuoteNotFound
+	}
+	if err != nil {
+		q.apiFailure(w, r, "Failed to get quote", err)
+		return
+	}
+
+	q.writeJSON(w, r, http.StatusOK, quote)
+}
+
+// apiError writes a json error with the given status and code.
+func (q *QuoteDB) apiError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	q.writeJSON(w, r, status, errorResponse{Error: message, Code: code})
+}
+
+// apiFailure writes err as a json error. The package's errors get their own
+// status and code, anything else is logged with msg and reported as an
+// internal error without leaking its details.
+func (q *QuoteDB) apiFailure(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	for _, e := range apiErrors {
+		if errors.Is(err, e.err) {
+			q.apiError(w, r, e.status, e.code, e.err.Error())
+			return
+		}
+	}
+
+	q.logError(r, msg, err)
+	q.apiError(w, r, http.StatusInternalServerError, apiCodeInternal, "internal error")
+}
+
+// writeJSON writes v as the json response body.
+func (q *QuoteDB) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to marshal json", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,108 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	sqlGetAuthors = `SELECT id, author FROM quotes;`
+	sqlSetAuthor  = `UPDATE quotes SET author = ? WHERE id = ?;`
+)
+
+// TrimAuthor is the rule used to store authors when author trimming is
+// enabled: surrounding whitespace is trimmed and internal runs of whitespace
+// are collapsed so "Bob" and " Bob " are the same author, the casing is kept.
+func TrimAuthor(author string) string {
+	return strings.Join(strings.Fields(author), " ")
+}
+
+// NormalizeAuthor is the rule used to store authors when author
+// normalization is enabled: the author is trimmed like TrimAuthor and then
+// lowercased so "Bob", "bob" and "BOB " are all the same author.
+func NormalizeAuthor(author string) string {
+	return strings.ToLower(TrimAuthor(author))
+}
+
+// storedAuthor returns the author as it should be stored and looked up.
+func (q *QuoteDB) storedAuthor(author string) string {
+	switch {
+	case q.normalizeAuthors:
+		return NormalizeAuthor(author)
+	case q.trimAuthors:
+		return TrimAuthor(author)
+	}
+	return author
+}
+
+// NormalizeAllAuthors rewrites the author of every existing quote with
+// NormalizeAuthor, or TrimAuthor when only author trimming is enabled, it
+// returns the number of quotes that changed. Quotes added while either is
+// enabled are already rewritten, this is for those added before.
+func (q *QuoteDB) NormalizeAllAuthors() (int, error) {
+	normalize := NormalizeAuthor
+	if q.trimAuthors && !q.normalizeAuthors {
+		normalize = TrimAuthor
+	}
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	changed := 0
+	runTx := func() error {
+		rows, err := tx.Query(sqlGetAuthors)
+		if err != nil {
+			return dbError(err)
+		}
+
+		authors := make(map[int]string)
+		for rows.Next() {
+			var id int
+			var author string
+			if err = rows.Scan(&id, &author); err != nil {
+				if cerr := rows.Close(); cerr != nil {
+					return fmt.Errorf("failed to scan authors (%w) but also close authors: %v", dbError(err), cerr)
+				}
+				return fmt.Errorf("failed to scan authors: %w", dbError(err))
+			}
+
+			if normalized := normalize(author); normalized != author {
+				authors[id] = normalized
+			}
+		}
+
+		if err = rows.Close(); err != nil {
+			return fmt.Errorf("error closing author rows: %w", dbError(err))
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("error reading all author rows: %w", dbError(err))
+		}
+
+		for id, author := range authors {
+			if _, err = tx.Exec(sqlSetAuthor, author, id); err != nil {
+				return fmt.Errorf("failed to update author: %w", dbError(err))
+			}
+			changed++
+		}
+
+		return nil
+	}
+
+	err = runTx()
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return 0, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return 0, fmt.Errorf("failed to normalize authors: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit normalize authors: %w", dbError(err))
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,128 @@
+package quotes
+
+import (
+	"bytes"
+	"database/sql"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The quote card is a fixed size image, the text is wrapped to fit and cut
+// short with an ellipsis if it does not.
+const (
+	cardLineLen    = 52
+	cardMaxLines   = 8
+	cardTextTop    = 84
+	cardLineHeight = 24
+)
+
+// cardData is what the quote card is rendered with.
+type cardData struct {
+	ID     int
+	Lines  []cardLine
+	Author string
+	Score  int
+}
+
+// cardLine is a line of the quote and where it goes on the card.
+type cardLine struct {
+	Y    int
+	Text string
+}
+
+var cardTmpl = template.Must(template.New("card").Parse(card))
+
+// quoteCard renders a quote as an svg image for chat platforms that unfurl
+// images but not pages.
+func (q *QuoteDB) quoteCard(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	quote, err := q.GetQuote(id)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to get quote", err)
+		return
+	}
+
+	data := cardData{
+		ID:     quote.ID,
+		Author: quote.Author,
+		Score:  quote.Upvotes - quote.Downvotes,
+	}
+	for i, line := range wrapText(quote.Quote, cardLineLen, cardMaxLines) {
+		data.Lines = append(data.Lines, cardLine{Y: cardTextTop + i*cardLineHeight, Text: line})
+	}
+
+	buf := &bytes.Buffer{}
+	if err = cardTmpl.Execute(buf, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to execute card template", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	_, _ = io.Copy(w, buf)
+}
+
+// wrapText breaks text into lines of at most width characters at spaces,
+// keeping the line breaks it already has. Words longer than a line are
+// split. If there are more than maxLines the last one ends in an ellipsis.
+func wrapText(text string, width, maxLines int) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		var line []rune
+		for _, word := range strings.Fields(para) {
+			w := []rune(word)
+			for len(w) > 0 {
+				switch {
+				case len(line) == 0 && len(w) <= width:
+					line, w = w, nil
+				case len(line) != 0 && len(line)+1+len(w) <= width:
+					line = append(append(line, ' '), w...)
+					w = nil
+				case len(line) != 0:
+					lines = append(lines, string(line))
+					line = nil
+				default:
+					lines = append(lines, string(w[:width]))
+					w = w[width:]
+				}
+			}
+		}
+		if len(line) != 0 {
+			lines = append(lines, string(line))
+		}
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		if len(last) >= width {
+			last = last[:width-1]
+		}
+		lines[maxLines-1] = string(last) + "…"
+	}
+	return lines
+}
+
+const card = `<svg xmlns="http://www.w3.org/2000/svg" width="600" height="315" viewBox="0 0 600 315">
+  <rect width="600" height="315" rx="12" fill="#fafafa" stroke="#ddd"/>
+  <text x="32" y="44" font-family="Lato, sans-serif" font-size="16" fill="#888">Quote #{{.ID}}</text>
+  <text x="568" y="44" font-family="Lato, sans-serif" font-size="16" fill="#888" text-anchor="end">{{.Score}}</text>
+  <text font-family="Lato, sans-serif" font-size="18" fill="#222">
+    {{- range .Lines}}
+    <tspan x="32" y="{{.Y}}">{{.Text}}</tspan>
+    {{- end}}
+  </text>
+  <text x="568" y="291" font-family="Lato, sans-serif" font-size="16" fill="#555" text-anchor="end">— {{.Author}}</text>
+</svg>
+`
@@ -0,0 +1,88 @@
+package quotes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// checkpointModes are the modes PRAGMA wal_checkpoint understands.
+var checkpointModes = map[string]bool{
+	"PASSIVE":  true,
+	"FULL":     true,
+	"RESTART":  true,
+	"TRUNCATE": true,
+}
+
+// checkpointer runs Checkpoint periodically, see WithAutoCheckpoint.
+type checkpointer struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Checkpoint copies the pages in the write-ahead log back into the
+// database file, mode is one of SQLite's PASSIVE, FULL, RESTART or TRUNCATE
+// and empty means PASSIVE. Only TRUNCATE shrinks the -wal file, the others
+// let it be reused. Modes other than PASSIVE wait on other connections and
+// return ErrCheckpointBusy if they're kept busy for too long. It does
+// nothing unless the database is in WAL mode, which OpenDB uses.
+func (q *QuoteDB) Checkpoint(mode string) error {
+	mode = strings.ToUpper(mode)
+	if len(mode) == 0 {
+		mode = "PASSIVE"
+	}
+	if !checkpointModes[mode] {
+		return fmt.Errorf("unknown checkpoint mode: %s", mode)
+	}
+
+	var busy, logFrames, checkpointed int
+	err := q.db.QueryRow(`PRAGMA wal_checkpoint(`+mode+`);`).Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint: %w", dbError(err))
+	}
+	if busy != 0 && mode != "PASSIVE" {
+		return ErrCheckpointBusy
+	}
+
+	return nil
+}
+
+// startCheckpointer starts the periodic checkpoint if it's enabled.
+func (q *QuoteDB) startCheckpointer() {
+	if q.checkpointEvery <= 0 {
+		return
+	}
+
+	q.checkpoints.stop = make(chan struct{})
+	q.checkpoints.done = make(chan struct{})
+	go func() {
+		defer close(q.checkpoints.done)
+
+		ticker := time.NewTicker(q.checkpointEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := q.Checkpoint("TRUNCATE"); err != nil {
+					q.logger.Error("Failed to checkpoint", "err", err)
+				}
+			case <-q.checkpoints.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopCheckpointer stops the periodic checkpoint. It's safe to call more
+// than once, even at the same time, since the checkpoint itself never takes
+// the lock.
+func (q *QuoteDB) stopCheckpointer() {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.checkpoints.stop != nil {
+		close(q.checkpoints.stop)
+		<-q.checkpoints.done
+		q.checkpoints.stop = nil
+	}
+}
@@ -0,0 +1,192 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// sqlNetScore is upvotes - downvotes of the quote aliased as q.
+	sqlNetScore = `(q.upvotes - q.downvotes)`
+
+	sqlCountBelowScore = `SELECT COUNT(*) FROM quotes as q WHERE q.deleted_at IS NULL AND q.status = 'approved' AND ` + sqlNetScore + ` < ?;`
+	sqlGetBelowScore   = `SELECT q.id FROM quotes as q WHERE q.deleted_at IS NULL AND q.status = 'approved' AND ` + sqlNetScore + ` < ?;`
+)
+
+// CountBelowScore returns how many quotes have a net score (upvotes minus
+// downvotes) below threshold, which is how many DeleteBelowScore would
+// delete.
+func (q *QuoteDB) CountBelowScore(threshold int) (int, error) {
+	var count int
+	if err := q.db.QueryRow(sqlCountBelowScore, threshold).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count quotes below score: %w", dbError(err))
+	}
+
+	return count, nil
+}
+
+// DeleteBelowScore deletes every quote with a net score (upvotes minus
+// downvotes) below threshold in a single transaction and returns how many
+// were deleted. Like DelQuote, the quotes are only marked as deleted when
+// soft delete is enabled, otherwise their votes and the rest go with them.
+func (q *QuoteDB) DeleteBelowScore(threshold int) (int, error) {
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	var ids []int
+	runTx := func() error {
+		// The ids are gathered up front since deleting votes changes scores
+		rows, err := tx.Query(sqlGetBelowScore, threshold)
+		if err != nil {
+			return dbError(err)
+		}
+		for rows.Next() {
+			var id int
+			if err = rows.Scan(&id); err != nil {
+				if cerr := rows.Close(); cerr != nil {
+					return fmt.Errorf("failed to scan ids (%w) but also close ids: %v", dbError(err), cerr)
+				}
+				return fmt.Errorf("failed to scan ids: %w", dbError(err))
+			}
+			ids = append(ids, id)
+		}
+		if err = rows.Close(); err != nil {
+			return fmt.Errorf("error closing id rows: %w", dbError(err))
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("error reading all id rows: %w", dbError(err))
+		}
+
+		if q.softDelete {
+			now := time.Now().Unix()
+			for _, id := range ids {
+				if _, err = tx.Exec(sqlSoftDel, now, id); err != nil {
+					return fmt.Errorf("failed to soft delete quote: %w", dbError(err))
+				}
+			}
+			return nil
+		}
+
+		deletes := []struct {
+			sql, what string
+		}{
+			{sqlDelVotes, "votes"},
+			{sqlDelEdits, "edits"},
+			{sqlDelTags, "tags"},
+			{sqlDelReactions, "reactions"},
+			{sqlDelFavorites, "favorites"},
+			{sqlDelReports, "reports"},
+		}
+		for _, id := range ids {
+			for _, d := range deletes {
+				if _, err = tx.Exec(d.sql, id); err != nil {
+					return fmt.Errorf("failed deleting quote %s: %w", d.what, dbError(err))
+				}
+			}
+			if _, err = tx.Exec(sqlDel, id); err != nil {
+				return fmt.Errorf("failed deleting quote: %w", dbError(err))
+			}
+		}
+
+		return nil
+	}
+
+	if err = runTx(); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return 0, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return 0, fmt.Errorf("failed to delete below score: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit delete below score: %w", dbError(err))
+	}
+
+	q.Lock()
+	q.nQuotes -= len(ids)
+	q.nDeleted += uint64(len(ids))
+	q.Unlock()
+	return len(ids), nil
+}
+
+// Vacuum compacts the database file, which doesn't shrink on its own after
+// deletes, and refreshes the statistics the query planner uses to pick
+// indexes. It's meant to be run periodically, like nightly.
+//
+// VACUUM rewrites the whole database so it needs free disk space of up to
+// twice its size and blocks every other write until it's done. It can't be
+// run inside a transaction.
+func (q *QuoteDB) Vacuum() error {
+	for _, s := range []string{`VACUUM;`, `ANALYZE;`, `PRAGMA optimize;`} {
+		if _, err := q.db.Exec(s); err != nil {
+			return fmt.Errorf("failed to run %s: %w", s, dbError(err))
+		}
+	}
+
+	return nil
+}
+
+const (
+	sqlForeignKeyCheck = `PRAGMA foreign_key_check;`
+	sqlDelOrphanVotes  = `DELETE FROM votes WHERE quote_id NOT IN (SELECT id FROM quotes);`
+)
+
+// CheckIntegrity returns a description of every row that references a row
+// that doesn't exist, like a vote on a quote that's gone. Foreign keys are
+// enforced by OpenDB but databases written before that, or by other tools,
+// may still have such rows. See RepairOrphans.
+func (q *QuoteDB) CheckIntegrity() ([]string, error) {
+	rows, err := q.db.Query(sqlForeignKeyCheck)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check foreign keys: %w", dbError(err))
+	}
+
+	violations := make([]string, 0)
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err = rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan violations (%w) but also close violations: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan violations: %w", dbError(err))
+		}
+
+		if rowid.Valid {
+			violations = append(violations, fmt.Sprintf("%s row %d references a missing row in %s", table, rowid.Int64, parent))
+		} else {
+			violations = append(violations, fmt.Sprintf("%s has a row that references a missing row in %s", table, parent))
+		}
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing violation rows: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all violation rows: %w", dbError(err))
+	}
+
+	return violations, nil
+}
+
+// RepairOrphans deletes the votes on quotes that no longer exist, which
+// would otherwise be counted by the vote statistics. It returns how many
+// votes were deleted.
+func (q *QuoteDB) RepairOrphans() (int, error) {
+	res, err := q.db.Exec(sqlDelOrphanVotes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned votes: %w", dbError(err))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed getting rows affected: %w", dbError(err))
+	}
+
+	return int(n), nil
+}
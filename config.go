@@ -0,0 +1,130 @@
+package quotes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvFilename = "QUOTES_DB"
+	EnvWebAuth  = "QUOTES_WEB_AUTH"
+)
+
+// Config holds everything needed to open a QuoteDB with OpenWithConfig.
+type Config struct {
+	// Filename is the sqlite database to open, it's created if it does not
+	// exist. It can be a path or a file: uri with parameters for the driver,
+	// which take precedence over the ones OpenDB adds, and ":memory:" opens
+	// an in-memory database like OpenMemoryDB.
+	Filename string
+	// WebAuth is user:pass for the web server's basic auth, it's off when
+	// empty.
+	WebAuth string
+	// Threshold is the visibility threshold, DefaultThreshold is used when
+	// it's zero. A threshold of zero can be set with WithThreshold.
+	Threshold int
+	// MaxQuoteLen is how many characters a quote may have, the default of
+	// 4096 is used when it's zero, see WithMaxQuoteLength.
+	MaxQuoteLen int
+	// Logger replaces the default logger when not nil, see WithLogger.
+	Logger Logger
+	// AccessLog logs every web request, see WithAccessLog.
+	AccessLog bool
+	// AddRateLimit quotes may be added per author every AddRateWindow, it's
+	// off when either is zero, see WithAddRateLimit.
+	AddRateLimit  int
+	AddRateWindow time.Duration
+	// ContentFilter checks every new quote, and its author if FilterAuthors
+	// is set, see WithContentFilter.
+	ContentFilter ContentFilter
+	FilterAuthors bool
+	// AutoLockVotes locks quotes once they have that many votes, it's off
+	// when zero, see WithAutoLock.
+	AutoLockVotes int
+	// AllowedCIDRs are the networks, like 10.0.0.0/8, the web server serves,
+	// it serves everyone when empty. See WithAllowedNets.
+	AllowedCIDRs []string
+	// TrustProxy takes client addresses from X-Forwarded-For, see
+	// WithTrustedProxy.
+	TrustProxy bool
+	// CheckpointEvery checkpoints the write-ahead log periodically, it's off
+	// when zero, see WithAutoCheckpoint.
+	CheckpointEvery time.Duration
+	// Markdown shows quotes on the web page as markdown, see WithMarkdown.
+	Markdown bool
+	// DateLayout and Location control how the web page shows dates, see
+	// WithDateFormat.
+	DateLayout string
+	Location   *time.Location
+	// Options are applied after the fields above so they take precedence.
+	Options []Option
+}
+
+// ConfigFromEnv returns a Config with Filename and WebAuth read from the
+// QUOTES_DB and QUOTES_WEB_AUTH environment variables.
+func ConfigFromEnv() Config {
+	return Config{
+		Filename: os.Getenv(EnvFilename),
+		WebAuth:  os.Getenv(EnvWebAuth),
+	}
+}
+
+// OpenWithConfig opens the database described by c, see OpenDB.
+func OpenWithConfig(c Config) (*QuoteDB, error) {
+	if len(c.Filename) == 0 {
+		return nil, errors.New("no database filename configured")
+	}
+
+	var options []Option
+	if c.Threshold != 0 {
+		options = append(options, WithThreshold(c.Threshold))
+	}
+	if c.MaxQuoteLen != 0 {
+		options = append(options, WithMaxQuoteLength(c.MaxQuoteLen))
+	}
+	if c.Logger != nil {
+		options = append(options, WithLogger(c.Logger))
+	}
+	if c.AccessLog {
+		options = append(options, WithAccessLog())
+	}
+	if c.AddRateLimit > 0 && c.AddRateWindow > 0 {
+		options = append(options, WithAddRateLimit(c.AddRateLimit, c.AddRateWindow))
+	}
+	if c.ContentFilter != nil {
+		options = append(options, WithContentFilter(c.ContentFilter, c.FilterAuthors))
+	}
+	if c.AutoLockVotes > 0 {
+		options = append(options, WithAutoLock(c.AutoLockVotes))
+	}
+	if len(c.AllowedCIDRs) != 0 {
+		nets, err := parseCIDRs(c.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network: %w", err)
+		}
+		options = append(options, WithAllowedNets(nets))
+	}
+	if c.TrustProxy {
+		options = append(options, WithTrustedProxy())
+	}
+	if c.CheckpointEvery > 0 {
+		options = append(options, WithAutoCheckpoint(c.CheckpointEvery))
+	}
+	if c.Markdown {
+		options = append(options, WithMarkdown())
+	}
+	if len(c.DateLayout) != 0 || c.Location != nil {
+		options = append(options, WithDateFormat(c.DateLayout, c.Location))
+	}
+	options = append(options, c.Options...)
+
+	qdb := newQuoteDB(c.WebAuth, options)
+	if c.Filename == ":memory:" {
+		return qdb.openMemory()
+	}
+	return qdb.openSQLite(c.Filename, make(url.Values))
+}
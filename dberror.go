@@ -0,0 +1,46 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// databaseError marks an error from the database, it matches ErrDatabase
+// while keeping the driver's message and error.
+type databaseError struct {
+	err error
+}
+
+func (d databaseError) Error() string        { return d.err.Error() }
+func (d databaseError) Unwrap() error        { return d.err }
+func (d databaseError) Is(target error) bool { return target == ErrDatabase }
+
+// dbError marks err as coming from the database. nil and sql.ErrNoRows are
+// returned as is since not finding a row is not a failure of the database.
+func dbError(err error) error {
+	if err == nil || err == sql.ErrNoRows || errors.Is(err, ErrDatabase) {
+		return err
+	}
+	return databaseError{err: err}
+}
+
+// isUniqueViolation reports whether err is sqlite refusing a row that would
+// break a unique index.
+func isUniqueViolation(err error) bool {
+	var serr sqlite3.Error
+	return errors.As(err, &serr) && serr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// Ping checks that the database can still be reached, the error wraps
+// ErrDatabase if it can't.
+//
+// database/sql reconnects on its own when a connection goes bad, so there's
+// nothing to do but retry later. If the database file itself was moved or
+// deleted the QuoteDB must be closed and opened again, the same goes for
+// databases passed to OpenDBWith.
+func (q *QuoteDB) Ping(ctx context.Context) error {
+	return dbError(q.db.PingContext(ctx))
+}
@@ -0,0 +1,191 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// dumpVersion is the version of the Dump format, Load refuses dumps of any
+// other version.
+const dumpVersion = 1
+
+const (
+	sqlDumpQuotes = `SELECT id, date, author, quote, source, collection, submitter, status, views, locked, pinned_at, deleted_at ` +
+		`FROM quotes ORDER BY id asc;`
+	sqlDumpVotes = `SELECT quote_id, voter, vote, date FROM votes ORDER BY quote_id asc, date asc;`
+	sqlLoadQuote = `INSERT INTO quotes (id, date, author, quote, normalized_quote, normalized_author, ` +
+		`source, collection, submitter, status, views, locked, pinned_at, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	sqlLoadVote = `INSERT INTO votes (quote_id, voter, vote, date) VALUES (?, ?, ?, ?);`
+)
+
+// dump is the envelope written by Dump.
+type dump struct {
+	Version int         `json:"version"`
+	Quotes  []dumpQuote `json:"quotes"`
+	Votes   []dumpVote  `json:"votes"`
+}
+
+// dumpQuote is a row of the quotes table, dates are unix seconds.
+type dumpQuote struct {
+	ID         int    `json:"id"`
+	Date       int64  `json:"date"`
+	Author     string `json:"author"`
+	Quote      string `json:"quote"`
+	Source     string `json:"source,omitempty"`
+	Collection string `json:"collection,omitempty"`
+	Submitter  string `json:"submitter,omitempty"`
+	Status     string `json:"status"`
+	Views      int    `json:"views,omitempty"`
+	Locked     bool   `json:"locked,omitempty"`
+	PinnedAt   *int64 `json:"pinned_at,omitempty"`
+	DeletedAt  *int64 `json:"deleted_at,omitempty"`
+}
+
+// dumpVote is a row of the votes table, dates are unix seconds.
+type dumpVote struct {
+	QuoteID int    `json:"quote_id"`
+	Voter   string `json:"voter"`
+	Vote    int    `json:"vote"`
+	Date    int64  `json:"date"`
+}
+
+// Dump writes every quote and vote to w as a single json document that Load
+// can restore, it's meant for backups and moving a database between
+// machines. Deleted and hidden quotes are included so nothing is lost.
+func (q *QuoteDB) Dump(w io.Writer) error {
+	d := dump{
+		Version: dumpVersion,
+		Quotes:  make([]dumpQuote, 0),
+		Votes:   make([]dumpVote, 0),
+	}
+
+	err := q.ReadTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(sqlDumpQuotes)
+		if err != nil {
+			return fmt.Errorf("failed to dump quotes: %w", dbError(err))
+		}
+		for rows.Next() {
+			var quote dumpQuote
+			err = rows.Scan(&quote.ID, &quote.Date, &quote.Author, &quote.Quote,
+				&quote.Source, &quote.Collection, &quote.Submitter, &quote.Status, &quote.Views, &quote.Locked, &quote.PinnedAt, &quote.DeletedAt)
+			if err != nil {
+				if cerr := rows.Close(); cerr != nil {
+					return fmt.Errorf("failed to scan quotes (%w) but also close quotes: %v", dbError(err), cerr)
+				}
+				return fmt.Errorf("failed to scan quotes: %w", dbError(err))
+			}
+			d.Quotes = append(d.Quotes, quote)
+		}
+		if err = rows.Close(); err != nil {
+			return fmt.Errorf("error closing quote rows: %w", dbError(err))
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("error reading all quote rows: %w", dbError(err))
+		}
+
+		rows, err = tx.Query(sqlDumpVotes)
+		if err != nil {
+			return fmt.Errorf("failed to dump votes: %w", dbError(err))
+		}
+		for rows.Next() {
+			var vote dumpVote
+			if err = rows.Scan(&vote.QuoteID, &vote.Voter, &vote.Vote, &vote.Date); err != nil {
+				if cerr := rows.Close(); cerr != nil {
+					return fmt.Errorf("failed to scan votes (%w) but also close votes: %v", dbError(err), cerr)
+				}
+				return fmt.Errorf("failed to scan votes: %w", dbError(err))
+			}
+			d.Votes = append(d.Votes, vote)
+		}
+		if err = rows.Close(); err != nil {
+			return fmt.Errorf("error closing vote rows: %w", dbError(err))
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("error reading all vote rows: %w", dbError(err))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(d); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+
+	return nil
+}
+
+// Load restores a dump written by Dump, keeping the ids of the quotes and
+// the history of the votes. It's all or nothing, if any quote's id is
+// already taken nothing is loaded, so it's meant to be used on a new
+// database. It returns the number of quotes loaded.
+func (q *QuoteDB) Load(r io.Reader) (imported int, err error) {
+	var d dump
+	if err = json.NewDecoder(r).Decode(&d); err != nil {
+		return 0, fmt.Errorf("failed to read dump: %w", err)
+	}
+	if d.Version != dumpVersion {
+		return 0, fmt.Errorf("unsupported dump version %d", d.Version)
+	}
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	runTx := func() error {
+		for _, quote := range d.Quotes {
+			status := quote.Status
+			if len(status) == 0 {
+				status = statusApproved
+			}
+			_, err = tx.Exec(sqlLoadQuote, quote.ID, quote.Date, quote.Author, quote.Quote,
+				normalizeQuote(quote.Quote), NormalizeAuthor(quote.Author),
+				quote.Source, quote.Collection, quote.Submitter, status, quote.Views, quote.Locked, quote.PinnedAt, quote.DeletedAt)
+			if err != nil {
+				return fmt.Errorf("failed to load quote %d: %w", quote.ID, dbError(err))
+			}
+		}
+
+		for _, vote := range d.Votes {
+			if vote.Vote == 0 {
+				return errors.New("vote must not be 0")
+			}
+			_, err = tx.Exec(sqlLoadVote, vote.QuoteID, vote.Voter, vote.Vote, vote.Date)
+			if err != nil {
+				return fmt.Errorf("failed to load vote on quote %d: %w", vote.QuoteID, dbError(err))
+			}
+		}
+
+		if _, err = tx.Exec(sqlRecountScores); err != nil {
+			return fmt.Errorf("failed to count scores: %w", dbError(err))
+		}
+
+		return nil
+	}
+
+	if err = runTx(); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return 0, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return 0, fmt.Errorf("failed to load dump: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit load: %w", dbError(err))
+	}
+
+	if err = q.RefreshCount(); err != nil {
+		return len(d.Quotes), err
+	}
+
+	return len(d.Quotes), nil
+}
@@ -0,0 +1,54 @@
+package quotes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// sqlGetIndexState is cheap to run and changes whenever a quote is added,
+// deleted, edited, pinned or unpinned or a vote is cast or removed.
+const sqlGetIndexState = `SELECT ` +
+	`(SELECT COALESCE(MAX(id), 0) FROM quotes), ` +
+	`(SELECT COUNT(*) FROM quotes WHERE deleted_at IS NULL AND status = 'approved'), ` +
+	`(SELECT COALESCE(MAX(id), 0) FROM edits), ` +
+	`(SELECT COALESCE(MAX(date), 0) FROM votes), ` +
+	`(SELECT COUNT(*) FROM votes), ` +
+	`(SELECT COALESCE(SUM(vote), 0) FROM votes), ` +
+	`(SELECT COALESCE(SUM(pinned_at), 0) FROM quotes), ` +
+	`(SELECT COUNT(pinned_at) FROM quotes);`
+
+// indexETag returns a weak etag for the index page as r would see it. Since
+// the page shows the voter's own votes and their csrf token those are part
+// of it as well as the state of the database.
+func (q *QuoteDB) indexETag(r *http.Request) (string, error) {
+	var maxID, nQuotes, maxEdit, lastVote, nVotes, sumVotes, sumPinned, nPinned int64
+	err := q.db.QueryRow(sqlGetIndexState).Scan(&maxID, &nQuotes, &maxEdit, &lastVote, &nVotes, &sumVotes, &sumPinned, &nPinned)
+	if err != nil {
+		return "", fmt.Errorf("failed to get index state: %w", dbError(err))
+	}
+
+	var token string
+	if cookie, err := r.Cookie(csrfCookie); err == nil {
+		token = cookie.Value
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%d:%d:%d:%d:%d:%d:%d:%s:%s",
+		maxID, nQuotes, maxEdit, lastVote, nVotes, sumVotes, sumPinned, nPinned, q.webVoter(r), token)))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether the If-None-Match header matches etag, using
+// the weak comparison that's required for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package quotes
+
+import (
+	"database/sql"
+)
+
+// EventType is what happened in an Event.
+type EventType int
+
+// The events passed to the handler set with WithEventHandler.
+const (
+	// QuoteAdded is sent when a quote is added, Quote is the new quote. When
+	// moderation is enabled it's only sent once the quote is approved.
+	QuoteAdded EventType = iota
+	// VoteCast is sent when a vote is cast or changed with Upvote, Downvote
+	// or SetVote. Quote has the counts after the vote, Voter and Vote are who
+	// voted and which way.
+	VoteCast
+	// MilestoneReached is sent along with VoteCast when the vote takes the
+	// quote's score (upvotes minus downvotes) to Milestone or above.
+	MilestoneReached
+)
+
+// Event is something that happened to the quotes, see WithEventHandler.
+type Event struct {
+	Type      EventType
+	Quote     Quote
+	Voter     string
+	Vote      Direction
+	Milestone int
+}
+
+// voteMilestones are the scores that cause a MilestoneReached event.
+var voteMilestones = []int{10, 25, 50, 100, 250, 500, 1000}
+
+const sqlGetScore = `SELECT COALESCE(SUM(vote), 0) FROM votes WHERE quote_id = ?;`
+
+// emit sends e to the event handler, if any, in its own goroutine.
+func (q *QuoteDB) emit(e Event) {
+	if q.onEvent == nil {
+		return
+	}
+
+	go q.onEvent(e)
+}
+
+// emitAdded sends the QuoteAdded event of the quote id.
+func (q *QuoteDB) emitAdded(id int) {
+	if q.onEvent == nil {
+		return
+	}
+
+	quote, err := q.GetQuote(id)
+	if err != nil {
+		q.logger.Error("Failed to get quote for added event", "id", id, "err", err)
+		return
+	}
+
+	q.emit(Event{Type: QuoteAdded, Quote: quote})
+}
+
+// scoreBefore returns the quote's score before a vote changes it, it's only
+// looked up when there's an event handler that could need it.
+func (q *QuoteDB) scoreBefore(tx *sql.Tx, id int) (int, error) {
+	if q.onEvent == nil {
+		return 0, nil
+	}
+
+	var score int
+	if err := tx.QueryRow(sqlGetScore, id).Scan(&score); err != nil {
+		return 0, dbError(err)
+	}
+	return score, nil
+}
+
+// emitVote sends the events for a vote of direction by voter, before is the
+// score of the quote before the vote.
+func (q *QuoteDB) emitVote(id int, voter string, direction Direction, before int) {
+	if q.onEvent == nil {
+		return
+	}
+
+	quote, err := q.GetQuote(id)
+	if err != nil {
+		q.logger.Error("Failed to get quote for vote event", "id", id, "err", err)
+		return
+	}
+
+	q.emit(Event{Type: VoteCast, Quote: quote, Voter: voter, Vote: direction})
+
+	after := quote.Upvotes - quote.Downvotes
+	for _, m := range voteMilestones {
+		if before < m && after >= m {
+			q.emit(Event{Type: MilestoneReached, Quote: quote, Voter: voter, Vote: direction, Milestone: m})
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package quotes
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	sqlCreateFavoritesTable = `CREATE TABLE IF NOT EXISTS favorites (` +
+		`user TEXT NOT NULL,` +
+		`quote_id INTEGER NOT NULL,` +
+		`date INTEGER NOT NULL,` +
+		`PRIMARY KEY (user, quote_id),` +
+		`FOREIGN KEY (quote_id) REFERENCES quotes (id))`
+	sqlFavoriteQuoteIDIndex = `CREATE INDEX IF NOT EXISTS favoritesquoteid ON favorites (quote_id);`
+
+	sqlAddFavorite    = `INSERT OR IGNORE INTO favorites (user, quote_id, date) VALUES (?, ?, ?);`
+	sqlRemoveFavorite = `DELETE FROM favorites WHERE user = ? AND quote_id = ?;`
+	sqlDelFavorites   = `DELETE FROM favorites WHERE quote_id = ?;`
+	sqlPurgeFavorites = `DELETE FROM favorites WHERE quote_id IN (SELECT id FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?);`
+	sqlMergeFavorites = `UPDATE OR IGNORE favorites SET quote_id = ? WHERE quote_id = ?;`
+
+	sqlGetFavorites = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`INNER JOIN favorites as f ON f.quote_id = q.id ` +
+		`WHERE f.user = ? AND q.deleted_at IS NULL AND q.status = 'approved' ` +
+		`ORDER BY f.date desc, q.id desc;`
+)
+
+// AddFavorite saves a quote to the user's favorites, adding a quote that's
+// already a favorite is not an error.
+func (q *QuoteDB) AddFavorite(user string, id int) error {
+	var quoteExists int
+	if err := q.db.QueryRow(sqlHasQuote, id).Scan(&quoteExists); err != nil {
+		return dbError(err)
+	}
+	if quoteExists == 0 {
+		return ErrQuoteNotFound
+	}
+
+	if _, err := q.db.Exec(sqlAddFavorite, user, id, time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to add favorite: %w", dbError(err))
+	}
+
+	return nil
+}
+
+// RemoveFavorite removes a quote from the user's favorites, removing a quote
+// that's not a favorite is not an error.
+func (q *QuoteDB) RemoveFavorite(user string, id int) error {
+	if _, err := q.db.Exec(sqlRemoveFavorite, user, id); err != nil {
+		return fmt.Errorf("failed to remove favorite: %w", dbError(err))
+	}
+
+	return nil
+}
+
+// GetFavorites returns the user's favorite quotes, most recently added first.
+func (q *QuoteDB) GetFavorites(user string) ([]Quote, error) {
+	return q.queryQuotes(sqlGetFavorites, user)
+}
@@ -0,0 +1,107 @@
+package quotes
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	feedDefaultLimit = 20
+	feedMaxLimit     = 100
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// quotesFeed renders the most recent quotes as an atom feed, the number of
+// entries can be controlled with ?limit=
+func (q *QuoteDB) quotesFeed(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	limit := queryInt(r.URL.Query(), "limit", feedDefaultLimit, feedMaxLimit)
+
+	quotes, err := q.RecentQuotes(limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to get recent quotes", err)
+		return
+	}
+
+	scheme := "http"
+	if q.secureRequest(r) {
+		scheme = "https"
+	}
+	base := fmt.Sprintf("%s://%s%s", scheme, r.Host, q.basePath)
+
+	feed := atomFeed{
+		Title:   "Quotes",
+		ID:      base + "/",
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: base + "/feed", Rel: "self"},
+		Entries: make([]atomEntry, len(quotes)),
+	}
+	if len(quotes) != 0 {
+		feed.Updated = quotes[0].Date.Format(time.RFC3339)
+	}
+
+	for i, quote := range quotes {
+		permalink := fmt.Sprintf("%s/quote/%d", base, quote.ID)
+		date := quote.Date.Format(time.RFC3339)
+		feed.Entries[i] = atomEntry{
+			Title:     fmt.Sprintf("Quote #%d", quote.ID),
+			ID:        permalink,
+			Link:      atomLink{Href: permalink},
+			Published: date,
+			Updated:   date,
+			Author:    atomAuthor{Name: quote.Author},
+			Content:   atomContent{Type: "text", Body: quote.Quote},
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	if err = xml.NewEncoder(buf).Encode(feed); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to encode feed", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	_, _ = io.Copy(w, buf)
+}
@@ -0,0 +1,126 @@
+package quotes
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest response that's compressed, smaller ones
+// aren't worth the overhead.
+const gzipMinSize = 1024
+
+// gzipHandler compresses the responses of next for clients that accept
+// gzip.
+func gzipHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, enc := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(enc, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(key) == "q" {
+				weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				return err == nil && weight > 0
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// gzipResponseWriter holds back the response until gzipMinSize bytes have
+// been written, then decides whether to compress it. Responses that end
+// before that are written as is.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+// WriteHeader records the status, it's written once the body is decided on.
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if !g.decided {
+		g.status = status
+	}
+}
+
+// Write buffers b until the response is big enough to compress.
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(b)
+		}
+		return g.ResponseWriter.Write(b)
+	}
+
+	g.buf = append(g.buf, b...)
+	if len(g.buf) < gzipMinSize {
+		return len(b), nil
+	}
+
+	if err := g.decide(true); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// decide writes the header and the buffered body, compressed if compress is
+// true and the response may be compressed.
+func (g *gzipResponseWriter) decide(compress bool) error {
+	g.decided = true
+
+	header := g.Header()
+	if compress && len(header.Get("Content-Encoding")) == 0 &&
+		g.status != http.StatusNoContent && g.status != http.StatusNotModified {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+
+	g.ResponseWriter.WriteHeader(g.status)
+	if len(g.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(g.buf)
+	} else {
+		_, err = g.ResponseWriter.Write(g.buf)
+	}
+	g.buf = nil
+	return err
+}
+
+// finish writes whatever is left of the response.
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		_ = g.decide(false)
+	}
+	if g.gz != nil {
+		_ = g.gz.Close()
+	}
+}
@@ -0,0 +1,157 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The longest quote and author that can be added, in characters. The quote
+// length can be changed with WithMaxQuoteLength.
+const (
+	maxQuoteLength  = 4096
+	maxAuthorLength = 256
+)
+
+// ValidationError describes why a quote can't be added, it wraps
+// ErrInvalidQuote.
+type ValidationError struct {
+	// Field is "author" or "quote".
+	Field   string
+	Problem string
+}
+
+// Error implements error.
+func (v *ValidationError) Error() string {
+	return v.Field + " " + v.Problem
+}
+
+// Unwrap returns ErrInvalidQuote.
+func (v *ValidationError) Unwrap() error {
+	return ErrInvalidQuote
+}
+
+// validateQuote returns a *ValidationError when a quote can't be added.
+func (q *QuoteDB) validateQuote(author, quote string) error {
+	switch {
+	case len(strings.TrimSpace(quote)) == 0:
+		return &ValidationError{Field: "quote", Problem: "must not be empty"}
+	case q.maxQuoteLen > 0 && utf8.RuneCountInString(quote) > q.maxQuoteLen:
+		return &ValidationError{Field: "quote", Problem: fmt.Sprintf("must not be longer than %d characters", q.maxQuoteLen)}
+	case utf8.RuneCountInString(author) > maxAuthorLength:
+		return &ValidationError{Field: "author", Problem: fmt.Sprintf("must not be longer than %d characters", maxAuthorLength)}
+	}
+
+	return nil
+}
+
+// ImportMode decides what ImportQuotes does with rows it can't import.
+type ImportMode int
+
+const (
+	// ImportStrict imports every row or none of them, the first bad row
+	// stops the import.
+	ImportStrict ImportMode = iota
+	// ImportLenient skips bad rows and imports the rest, the skipped rows
+	// are reported in the ImportResult.
+	ImportLenient
+)
+
+// ImportQuote is a single row given to ImportQuotes, a zero Date is the
+// time of the import.
+type ImportQuote struct {
+	Author string
+	Quote  string
+	Source string
+	Date   time.Time
+}
+
+// ImportRow is the outcome of a single row of an import, either the id of
+// the added quote or why it wasn't added. Err is a *ValidationError for
+// invalid rows, ErrRejectedContent for rows the ContentFilter rejected and
+// ErrDuplicate for duplicates, which also set ID to the existing quote's id.
+type ImportRow struct {
+	ID  int64
+	Err error
+}
+
+// ImportResult holds the outcome of every row of an import in the order
+// they were given.
+type ImportResult struct {
+	Rows     []ImportRow
+	Imported int
+	Skipped  int
+}
+
+// ImportQuotes adds many quotes in a single transaction, what happens to
+// rows that can't be added is decided by mode. In strict mode the error
+// names the first bad row and nothing is imported. Rows are checked like
+// AddQuote checks its quotes, except for the rate limit which doesn't apply.
+func (q *QuoteDB) ImportQuotes(rows []ImportQuote, mode ImportMode) (ImportResult, error) {
+	result := ImportResult{Rows: make([]ImportRow, len(rows))}
+
+	q.Lock()
+	defer q.Unlock()
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return ImportResult{}, dbError(err)
+	}
+
+	now := time.Now()
+	runTx := func() error {
+		for i, row := range rows {
+			date := row.Date
+			if date.IsZero() {
+				date = now
+			}
+
+			var id int64
+			author, quote, err := q.filterContent(row.Author, row.Quote)
+			if err == nil {
+				err = q.validateQuote(author, quote)
+			}
+			if err == nil {
+				id, err = q.insertQuote(tx, "", q.storedAuthor(author), quote, row.Source, "", date)
+			}
+
+			var verr *ValidationError
+			isBadRow := errors.As(err, &verr) || errors.Is(err, ErrDuplicate) || errors.Is(err, ErrRejectedContent)
+			switch {
+			case err == nil:
+				result.Rows[i].ID = id
+				result.Imported++
+			case isBadRow && mode == ImportLenient:
+				result.Rows[i] = ImportRow{ID: id, Err: err}
+				result.Skipped++
+			case isBadRow:
+				return fmt.Errorf("row %d: %w", i, err)
+			default:
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err = runTx(); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return ImportResult{}, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return ImportResult{}, fmt.Errorf("failed to import quotes: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return ImportResult{}, fmt.Errorf("failed to commit import: %w", dbError(err))
+	}
+
+	if !q.moderation {
+		q.nQuotes += result.Imported
+	}
+	q.nAdded += uint64(result.Imported)
+	return result, nil
+}
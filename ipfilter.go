@@ -0,0 +1,83 @@
+package quotes
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the ip of the client that made the request. That's the
+// address the request came from, unless the server is behind a trusted
+// proxy in which case it's the last address of X-Forwarded-For: the one the
+// proxy added. Earlier addresses are whatever the client sent so they're
+// never used.
+func (q *QuoteDB) clientIP(r *http.Request) string {
+	if q.trustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) != 0 {
+			last := fwd[len(fwd)-1]
+			if i := strings.LastIndexByte(last, ','); i >= 0 {
+				last = last[i+1:]
+			}
+			if last = strings.TrimSpace(last); len(last) != 0 {
+				return last
+			}
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// secureRequest reports whether the client made the request over https,
+// behind a trusted proxy that's what the proxy says in X-Forwarded-Proto.
+func (q *QuoteDB) secureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return q.trustProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// allowedHandler responds with 403 Forbidden to clients outside of the
+// allowed networks rather than passing their requests on to next.
+func (q *QuoteDB) allowedHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(q.clientIP(r))
+		for _, n := range q.allowedNets {
+			if ip != nil && n.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+	})
+}
+
+// parseCIDRs parses networks like 10.0.0.0/8, a single address like
+// 192.168.1.10 is a network of its own.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
@@ -0,0 +1,105 @@
+package quotes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Logger receives the errors the web server runs into, and its requests when
+// WithAccessLog is used. Args are alternating keys and values, this matches
+// the Error method of *slog.Logger so one can be used directly.
+type Logger interface {
+	Error(msg string, args ...interface{})
+}
+
+// infoLogger is a Logger that also has an Info level like *slog.Logger, the
+// access log uses it when it's available.
+type infoLogger interface {
+	Info(msg string, args ...interface{})
+}
+
+// stdLogger is the default Logger which writes to the standard log package.
+type stdLogger struct{}
+
+// Error logs msg followed by the args as key=value pairs.
+func (stdLogger) Error(msg string, args ...interface{}) {
+	logKeyValues(msg, args)
+}
+
+// Info logs msg followed by the args as key=value pairs.
+func (stdLogger) Info(msg string, args ...interface{}) {
+	logKeyValues(msg, args)
+}
+
+// logKeyValues writes msg and the args as key=value pairs to the standard log
+// package.
+func logKeyValues(msg string, args []interface{}) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+
+	log.Println(b.String())
+}
+
+// logError logs an error that occurred while serving r.
+func (q *QuoteDB) logError(r *http.Request, msg string, err error) {
+	q.logger.Error(msg, "err", err, "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+}
+
+// accessLogHandler logs every request served by next with its status, size
+// and how long it took. Only the basic auth user is logged, never the
+// password.
+func (q *QuoteDB) accessLogHandler(next http.Handler) http.Handler {
+	logf := q.logger.Error
+	if l, ok := q.logger.(infoLogger); ok {
+		logf = l.Info
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		user, _, _ := r.BasicAuth()
+		logf("Request", "method", r.Method, "path", r.URL.Path, "status", sw.status,
+			"bytes", sw.bytes, "duration", time.Since(start), "remote", r.RemoteAddr, "user", user)
+	})
+}
+
+// statusWriter records the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int
+}
+
+// WriteHeader records the status of the response.
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes of the response.
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
@@ -0,0 +1,49 @@
+package quotes
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// The markdown renderMarkdown understands. They're matched against text
+// that's already html escaped, which leaves *, _ and ` alone.
+var (
+	markdownBold  = regexp.MustCompile(`\*\*([^*\s](?:[^*]*[^*\s])?)\*\*`)
+	markdownStar  = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+	markdownUnder = regexp.MustCompile(`(^|[^\w])_([^_\s](?:[^_]*[^_\s])?)_([^\w]|$)`)
+)
+
+// renderMarkdown renders the bold, italics and code spans of a quote's
+// markdown as html. Everything else, html included, is shown as text: the
+// quote is escaped before the markdown is rendered so the only tags in the
+// result are <strong>, <em> and <code>, without attributes.
+func renderMarkdown(text string) template.HTML {
+	var b strings.Builder
+
+	// Code spans come first since nothing inside them is markdown.
+	parts := strings.Split(text, "`")
+	for i, part := range parts {
+		switch {
+		case i%2 == 1 && i < len(parts)-1:
+			b.WriteString("<code>")
+			b.WriteString(template.HTMLEscapeString(part))
+			b.WriteString("</code>")
+		case i%2 == 1:
+			// An unclosed backtick is just a backtick.
+			b.WriteString("`")
+			b.WriteString(renderEmphasis(template.HTMLEscapeString(part)))
+		default:
+			b.WriteString(renderEmphasis(template.HTMLEscapeString(part)))
+		}
+	}
+
+	return template.HTML(b.String())
+}
+
+// renderEmphasis renders bold and italics in escaped text.
+func renderEmphasis(escaped string) string {
+	escaped = markdownBold.ReplaceAllString(escaped, "<strong>$1</strong>")
+	escaped = markdownStar.ReplaceAllString(escaped, "<em>$1</em>")
+	return markdownUnder.ReplaceAllString(escaped, "$1<em>$2</em>$3")
+}
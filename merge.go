@@ -0,0 +1,121 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	// UPDATE OR IGNORE leaves rows that would collide with one the kept quote
+	// already has on the merged quote, they're deleted afterwards.
+	sqlMergeVotes     = `UPDATE OR IGNORE votes SET quote_id = ? WHERE quote_id = ?;`
+	sqlMergeTags      = `UPDATE OR IGNORE tags SET quote_id = ? WHERE quote_id = ?;`
+	sqlMergeReactions = `UPDATE OR IGNORE reactions SET quote_id = ? WHERE quote_id = ?;`
+)
+
+// MergeQuotes merges the quote mergeID into keepID, it's meant for
+// duplicates that slipped in. The votes, tags, reactions, favorites and
+// reports of mergeID are moved to keepID, where a voter voted on both quotes
+// the vote on keepID is kept. mergeID and its edit history are then deleted.
+// Either quote may be waiting for moderation. It returns ErrQuoteNotFound if
+// either quote does not exist.
+func (q *QuoteDB) MergeQuotes(keepID, mergeID int) error {
+	if keepID == mergeID {
+		return errors.New("cannot merge a quote into itself")
+	}
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return dbError(err)
+	}
+
+	var mergedStatus string
+	runTx := func() error {
+		// Either quote may still be waiting for moderation, a pending
+		// duplicate of an approved quote is the usual thing to merge.
+		for _, id := range []int{keepID, mergeID} {
+			var status string
+			err = tx.QueryRow(sqlGetStatus, id).Scan(&status)
+			if err == sql.ErrNoRows {
+				return ErrQuoteNotFound
+			} else if err != nil {
+				return dbError(err)
+			}
+			if id == mergeID {
+				mergedStatus = status
+			}
+		}
+
+		moves := []struct {
+			sql, what string
+		}{
+			{sqlMergeVotes, "votes"},
+			{sqlMergeTags, "tags"},
+			{sqlMergeReactions, "reactions"},
+			{sqlMergeFavorites, "favorites"},
+			{sqlMergeReports, "reports"},
+		}
+		for _, m := range moves {
+			if _, err = tx.Exec(m.sql, keepID, mergeID); err != nil {
+				return fmt.Errorf("failed moving quote %s: %w", m.what, dbError(err))
+			}
+		}
+
+		if _, err = tx.Exec(sqlDelVotes, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote votes: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlRecountScore, keepID); err != nil {
+			return fmt.Errorf("failed recounting quote score: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelTags, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote tags: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelReactions, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote reactions: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelFavorites, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote favorites: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelReports, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote reports: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelEdits, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote edits: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDel, mergeID); err != nil {
+			return fmt.Errorf("failed deleting quote: %w", dbError(err))
+		}
+
+		return nil
+	}
+
+	if err = runTx(); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		if errors.Is(err, ErrQuoteNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to merge quotes: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merge quotes: %w", dbError(err))
+	}
+
+	if mergedStatus == statusApproved {
+		q.Lock()
+		q.nQuotes--
+		q.Unlock()
+	}
+	return nil
+}
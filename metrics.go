@@ -0,0 +1,40 @@
+package quotes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// quotesMetrics writes counters and gauges in the prometheus text format.
+func (q *QuoteDB) quotesMetrics(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	var nVotes int
+	if err := q.db.QueryRow(sqlGetVoteCount).Scan(&nVotes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to count votes", err)
+		return
+	}
+
+	q.RLock()
+	nQuotes, nAdded, nVoted, nDeleted := q.nQuotes, q.nAdded, q.nVoted, q.nDeleted
+	q.RUnlock()
+
+	buf := &bytes.Buffer{}
+	writeMetric(buf, "quotes_quotes", "gauge", "Number of quotes in the database.", nQuotes)
+	writeMetric(buf, "quotes_votes", "gauge", "Number of votes in the database.", nVotes)
+	writeMetric(buf, "quotes_added_total", "counter", "Quotes added since startup.", nAdded)
+	writeMetric(buf, "quotes_voted_total", "counter", "Votes cast since startup.", nVoted)
+	writeMetric(buf, "quotes_deleted_total", "counter", "Quotes deleted since startup.", nDeleted)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = io.Copy(w, buf)
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
@@ -0,0 +1,188 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a set of statements that move the schema forward, fn is run
+// after the statements for changes that cannot be expressed in plain sql.
+type migration struct {
+	statements []string
+	fn         func(tx *sql.Tx) error
+}
+
+// migrations are run in order after the tables have been created, each entry
+// is recorded in the migrations table by its 1-based index so it only ever
+// runs once against a given database.
+var migrations = []migration{
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN deleted_at INTEGER;`}},
+	{
+		statements: []string{
+			`ALTER TABLE quotes ADD COLUMN normalized_quote TEXT;`,
+			`CREATE INDEX IF NOT EXISTS quotesnormalized ON quotes (normalized_quote);`,
+		},
+		fn: backfillNormalizedQuotes,
+	},
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN source TEXT NOT NULL DEFAULT '';`}},
+	// votes.vote became a signed weight, existing votes of 1 and -1 are
+	// already correct so only the index changes to suit the range queries.
+	{statements: []string{`DROP INDEX IF EXISTS votesvote;`}},
+	{statements: []string{`ALTER TABLE edits ADD COLUMN author TEXT NOT NULL DEFAULT '';`}},
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN status TEXT NOT NULL DEFAULT 'approved';`}},
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN views INTEGER NOT NULL DEFAULT 0;`}},
+	{
+		statements: []string{`ALTER TABLE quotes ADD COLUMN normalized_author TEXT;`},
+		fn:         backfillNormalizedAuthors,
+	},
+	{
+		statements: []string{
+			`ALTER TABLE quotes ADD COLUMN collection TEXT NOT NULL DEFAULT '';`,
+			`CREATE INDEX IF NOT EXISTS quotescollection ON quotes (collection, id);`,
+		},
+	},
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN submitter TEXT NOT NULL DEFAULT '';`}},
+	{
+		statements: []string{
+			`ALTER TABLE quotes ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE quotes ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;`,
+			`UPDATE quotes SET ` +
+				`upvotes = (SELECT COALESCE(SUM(vote), 0) FROM votes WHERE quote_id = quotes.id AND vote > 0), ` +
+				`downvotes = (SELECT COALESCE(-SUM(vote), 0) FROM votes WHERE quote_id = quotes.id AND vote < 0);`,
+			`CREATE INDEX IF NOT EXISTS quotesscore ON quotes ((upvotes - downvotes));`,
+		},
+	},
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN locked INTEGER NOT NULL DEFAULT 0;`}},
+	{statements: []string{`ALTER TABLE quotes ADD COLUMN pinned_at INTEGER;`}},
+}
+
+// migrate runs any migrations that have not yet been applied.
+func (q *QuoteDB) migrate() error {
+	for i, m := range migrations {
+		version := i + 1
+
+		var applied int
+		if err := q.db.QueryRow(sqlHasMigration, version).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to check migration %d: %w", version, dbError(err))
+		}
+		if applied != 0 {
+			continue
+		}
+
+		tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+		if err != nil {
+			return dbError(err)
+		}
+
+		runTx := func() error {
+			for _, s := range m.statements {
+				if _, err := tx.Exec(s); err != nil {
+					return fmt.Errorf("error running sql statement:\nsql: %s\nerror: %w", s, dbError(err))
+				}
+			}
+
+			if m.fn != nil {
+				if err := m.fn(tx); err != nil {
+					return err
+				}
+			}
+
+			if _, err := tx.Exec(sqlAddMigration, version, time.Now().Unix()); err != nil {
+				return fmt.Errorf("failed to record migration: %w", dbError(err))
+			}
+
+			return nil
+		}
+
+		if err = runTx(); err != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				return fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+			}
+			return fmt.Errorf("failed to run migration %d: %w", version, err)
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", version, dbError(err))
+		}
+	}
+
+	return nil
+}
+
+// backfillNormalizedQuotes fills in normalized_quote for quotes that were
+// added before the column existed.
+func backfillNormalizedQuotes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, quote FROM quotes WHERE normalized_quote IS NULL;`)
+	if err != nil {
+		return dbError(err)
+	}
+
+	normalized := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var quote string
+		if err = rows.Scan(&id, &quote); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return fmt.Errorf("failed to scan quotes (%w) but also close quotes: %v", dbError(err), cerr)
+			}
+			return fmt.Errorf("failed to scan quotes: %w", dbError(err))
+		}
+
+		normalized[id] = normalizeQuote(quote)
+	}
+
+	if err = rows.Close(); err != nil {
+		return fmt.Errorf("error closing rows in backfill: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error reading all rows: %w", dbError(err))
+	}
+
+	for id, n := range normalized {
+		if _, err = tx.Exec(`UPDATE quotes SET normalized_quote = ? WHERE id = ?;`, n, id); err != nil {
+			return fmt.Errorf("failed to backfill normalized quote: %w", dbError(err))
+		}
+	}
+
+	return nil
+}
+
+// backfillNormalizedAuthors fills in normalized_author for quotes that were
+// added before the column existed.
+func backfillNormalizedAuthors(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, author FROM quotes WHERE normalized_author IS NULL;`)
+	if err != nil {
+		return dbError(err)
+	}
+
+	normalized := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var author string
+		if err = rows.Scan(&id, &author); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return fmt.Errorf("failed to scan quotes (%w) but also close quotes: %v", dbError(err), cerr)
+			}
+			return fmt.Errorf("failed to scan quotes: %w", dbError(err))
+		}
+
+		normalized[id] = NormalizeAuthor(author)
+	}
+
+	if err = rows.Close(); err != nil {
+		return fmt.Errorf("error closing rows in backfill: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error reading all rows: %w", dbError(err))
+	}
+
+	for id, n := range normalized {
+		if _, err = tx.Exec(`UPDATE quotes SET normalized_author = ? WHERE id = ?;`, n, id); err != nil {
+			return fmt.Errorf("failed to backfill normalized author: %w", dbError(err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package quotes
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The moderation states of a quote, only approved quotes are ever shown.
+const (
+	statusPending  = "pending"
+	statusApproved = "approved"
+	statusRejected = "rejected"
+)
+
+const (
+	sqlGetStatus = `SELECT status FROM quotes WHERE id = ? AND deleted_at IS NULL;`
+	sqlSetStatus = `UPDATE quotes SET status = ? WHERE id = ? AND deleted_at IS NULL;`
+	sqlSetLocked = `UPDATE quotes SET locked = ? WHERE id = ? AND deleted_at IS NULL;`
+	sqlAutoLock  = `UPDATE quotes SET locked = 1 WHERE id = ? AND locked = 0 AND upvotes + downvotes >= ?;`
+	sqlPin       = `UPDATE quotes SET pinned_at = COALESCE(pinned_at, ?) WHERE id = ? AND deleted_at IS NULL;`
+	sqlUnpin     = `UPDATE quotes SET pinned_at = NULL WHERE id = ? AND deleted_at IS NULL;`
+	sqlGetPinned = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.pinned_at IS NOT NULL ` +
+		`ORDER BY q.pinned_at desc, q.id desc;`
+	sqlGetPending = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'pending' ` +
+		`ORDER BY q.id asc;`
+)
+
+// Approve makes a quote visible, it's used on quotes added while moderation
+// is enabled but can also bring back a rejected quote. It returns
+// ErrQuoteNotFound if there is no such quote.
+//
+// The QuoteAdded event of a quote added while moderation is enabled is sent
+// when it's approved, a quote that was rejected is announced again.
+func (q *QuoteDB) Approve(id int) error {
+	old, err := q.setStatus(id, statusApproved)
+	if err != nil {
+		return err
+	}
+	if old != statusApproved {
+		q.emitAdded(id)
+	}
+
+	return nil
+}
+
+// Reject hides a quote without deleting it. It returns ErrQuoteNotFound if
+// there is no such quote.
+func (q *QuoteDB) Reject(id int) error {
+	_, err := q.setStatus(id, statusRejected)
+	return err
+}
+
+// GetPending returns the quotes waiting for a moderator to approve or
+// reject them, oldest first.
+func (q *QuoteDB) GetPending() ([]Quote, error) {
+	return q.queryQuotes(sqlGetPending)
+}
+
+// LockQuote stops a quote from being edited, so the quote people voted on
+// can't be changed out from under them. Edits of a locked quote fail with
+// ErrQuoteLocked. It returns ErrQuoteNotFound if there is no such quote.
+//
+// The method isn't named Lock since QuoteDB embeds its mutex.
+func (q *QuoteDB) LockQuote(id int) error {
+	return q.setLocked(id, true)
+}
+
+// UnlockQuote allows a locked quote to be edited again. Quotes locked by
+// WithAutoLock are locked again by the next vote while they have enough
+// votes. It returns ErrQuoteNotFound if there is no such quote.
+func (q *QuoteDB) UnlockQuote(id int) error {
+	return q.setLocked(id, false)
+}
+
+// Pin features a quote, GetAll and the web page list pinned quotes before
+// the others whatever their score or date, the most recently pinned first.
+// Pinning a pinned quote keeps its place. It returns ErrQuoteNotFound if
+// there is no such quote.
+func (q *QuoteDB) Pin(id int) error {
+	res, err := q.db.Exec(sqlPin, time.Now().Unix(), id)
+	if err != nil {
+		return fmt.Errorf("failed to pin quote: %w", dbError(err))
+	}
+
+	return quoteAffected(res)
+}
+
+// Unpin puts a pinned quote back in its normal place. It returns
+// ErrQuoteNotFound if there is no such quote.
+func (q *QuoteDB) Unpin(id int) error {
+	res, err := q.db.Exec(sqlUnpin, id)
+	if err != nil {
+		return fmt.Errorf("failed to unpin quote: %w", dbError(err))
+	}
+
+	return quoteAffected(res)
+}
+
+// GetPinned returns the pinned quotes, the most recently pinned first.
+func (q *QuoteDB) GetPinned() ([]Quote, error) {
+	return q.queryQuotes(sqlGetPinned)
+}
+
+// quoteAffected returns ErrQuoteNotFound unless res changed a quote.
+func quoteAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed getting rows affected: %w", dbError(err))
+	}
+	if n != 1 {
+		return ErrQuoteNotFound
+	}
+
+	return nil
+}
+
+// setLocked locks or unlocks a quote.
+func (q *QuoteDB) setLocked(id int, locked bool) error {
+	res, err := q.db.Exec(sqlSetLocked, locked, id)
+	if err != nil {
+		return fmt.Errorf("failed to lock quote: %w", dbError(err))
+	}
+
+	return quoteAffected(res)
+}
+
+// setStatus changes the moderation state of a quote, it returns the state
+// the quote was in before.
+func (q *QuoteDB) setStatus(id int, status string) (old string, err error) {
+	q.Lock()
+	defer q.Unlock()
+
+	err = q.db.QueryRow(sqlGetStatus, id).Scan(&old)
+	if err == sql.ErrNoRows {
+		return "", ErrQuoteNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get quote status: %w", dbError(err))
+	}
+
+	res, err := q.db.Exec(sqlSetStatus, status, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to set quote status: %w", dbError(err))
+	}
+	if err = quoteAffected(res); err != nil {
+		return "", err
+	}
+
+	return old, q.getCount()
+}
+
+// adjustCount changes the number of quotes by delta after a quote was
+// deleted or restored. When moderation is enabled that quote may not have
+// been counted so the quotes are recounted instead. q must be locked.
+func (q *QuoteDB) adjustCount(delta int) {
+	if !q.moderation {
+		q.nQuotes += delta
+		return
+	}
+
+	if err := q.getCount(); err != nil {
+		q.logger.Error("Failed to recount quotes", "err", err)
+	}
+}
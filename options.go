@@ -0,0 +1,376 @@
+package quotes
+
+import (
+	"html/template"
+	"net"
+	"path"
+	"time"
+)
+
+// Option changes the default behavior of a QuoteDB, they are passed to
+// OpenDB or OpenDBWith.
+type Option func(q *QuoteDB)
+
+// WithSoftDelete makes DelQuote mark quotes as deleted rather than removing
+// them so they can be recovered with RestoreQuote. Deleted quotes are hidden
+// from every query until they are restored or purged with PurgeDeleted.
+func WithSoftDelete() Option {
+	return func(q *QuoteDB) {
+		q.softDelete = true
+	}
+}
+
+// WithUniqueQuotes makes AddQuote refuse to add a quote whose text matches an
+// existing quote once surrounding whitespace is trimmed and internal runs of
+// whitespace are collapsed. The existing id is returned with ErrDuplicate.
+// Quotes waiting for moderation count but rejected quotes don't, so a
+// rejected quote can be submitted again.
+func WithUniqueQuotes() Option {
+	return func(q *QuoteDB) {
+		q.uniqueQuotes = true
+	}
+}
+
+// WithUniqueQuotesPerAuthor makes AddQuote refuse to add a quote when the
+// same author already has one with the same text, the same text attributed
+// to someone else is fine. Quote text is compared as in WithUniqueQuotes
+// and authors as by NormalizeAuthor. The existing id is returned with
+// ErrDuplicate.
+//
+// A unique index enforces this in the database too, so OpenDB fails if the
+// database already has such duplicates. Unlike WithUniqueQuotes every quote
+// that isn't deleted counts, including rejected ones, so a rejected quote
+// must be deleted before its author can submit it again.
+func WithUniqueQuotesPerAuthor() Option {
+	return func(q *QuoteDB) {
+		q.uniquePerAuthor = true
+	}
+}
+
+// WithModeration holds back new quotes until a moderator approves them with
+// Approve, until then they're only returned by GetPending. Quotes added
+// before moderation was enabled stay visible.
+func WithModeration() Option {
+	return func(q *QuoteDB) {
+		q.moderation = true
+	}
+}
+
+// WithVoteRateLimit allows each voter to make at most n calls to Upvote,
+// Downvote and Unvote per window, after which those calls fail with
+// ErrRateLimited until the voter's allowance refills. Opening the database
+// fails if window isn't positive.
+func WithVoteRateLimit(n int, window time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.voteLimiter = newRateLimiter(n, window)
+	}
+}
+
+// WithAddRateLimit allows each author to have at most n quotes added per
+// window, after which adding their quotes fails with ErrRateLimited until
+// the author's allowance refills. Authors are told apart by their
+// normalized name, see NormalizeAuthor. Opening the database fails if window
+// isn't positive.
+func WithAddRateLimit(n int, window time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.addLimiter = newRateLimiter(n, window)
+	}
+}
+
+// WithTemplate replaces the built-in page template served by StartServer,
+// use ParseTemplate to create one with the template functions available.
+// The template is executed with a value that has these fields:
+//
+//	NQuotes      int                 number of quotes on every page
+//	Quotes       []Quote             the quotes being shown
+//	Page         int                 the page being shown, from 1
+//	PerPage      int                 number of quotes per page
+//	TotalPages   int                 number of pages, at least 1
+//	PrevHref     template.HTMLAttr   href="..." to the previous page or empty
+//	NextHref     template.HTMLAttr   href="..." to the next page or empty
+//	Pages        []struct{Number int; Href template.HTMLAttr; Current bool}
+//	                                 links to the pages around this one
+//	AllHref      template.HTMLAttr   href="..." to show all quotes
+//	VotesortHref template.HTMLAttr   href="..." to sort quotes by votes
+//	Voter        string              authenticated user, empty if voting is off
+//	MyVotes      map[int]int         the voter's votes (1 or -1) by quote id
+//	CSRF         string              token vote forms must post as "csrf"
+//	Base         string              path prefix for links, see WithBasePath
+//	Markdown     bool                quotes are markdown, see WithMarkdown
+func WithTemplate(t *template.Template) Option {
+	return func(q *QuoteDB) {
+		q.tmpl = t
+	}
+}
+
+// WithThreshold changes the visibility threshold from DefaultThreshold,
+// quotes scoring at or below it are hidden wherever low quotes are left out.
+func WithThreshold(threshold int) Option {
+	return func(q *QuoteDB) {
+		q.threshold = threshold
+	}
+}
+
+// WithMaxQuoteLength changes how many characters a quote may have from the
+// default of 4096, longer quotes are rejected with a *ValidationError. A
+// length of 0 or less accepts quotes of any length.
+func WithMaxQuoteLength(n int) Option {
+	return func(q *QuoteDB) {
+		q.maxQuoteLen = n
+	}
+}
+
+// WithAutoLock locks quotes once they have at least votes upvotes plus
+// downvotes, as if LockQuote was called on them. Quotes are only locked when
+// they're voted on so quotes that already have enough votes stay unlocked
+// until their next vote.
+func WithAutoLock(votes int) Option {
+	return func(q *QuoteDB) {
+		q.autoLock = votes
+	}
+}
+
+// WithAllowedNets only serves web requests from clients in one of nets,
+// everyone else is refused with 403 Forbidden before basic auth is checked.
+// Everyone is served when nets is empty, like without the option. See
+// WithTrustedProxy for servers behind a reverse proxy.
+func WithAllowedNets(nets []*net.IPNet) Option {
+	return func(q *QuoteDB) {
+		q.allowedNets = append(make([]*net.IPNet, 0, len(nets)), nets...)
+	}
+}
+
+// WithTrustedProxy takes the client's address from the last entry of
+// X-Forwarded-For, the one added by the proxy, rather than from the
+// connection. The session cookie is also marked Secure when X-Forwarded-Proto
+// is https. It's for servers only reachable through a reverse proxy, set
+// anywhere else clients could pretend to be anyone.
+func WithTrustedProxy() Option {
+	return func(q *QuoteDB) {
+		q.trustProxy = true
+	}
+}
+
+// WithMarkdown shows quotes on the web page as markdown, only bold,
+// italics and code spans are rendered and any html in a quote is shown as
+// text. Quotes are stored and returned by the api as they were written.
+func WithMarkdown() Option {
+	return func(q *QuoteDB) {
+		q.markdown = true
+	}
+}
+
+// WithBasePath serves the web pages under a path prefix like /quotes so the
+// server can share a domain with others, every link on the pages includes
+// the prefix. Requests outside the prefix are not found.
+func WithBasePath(prefix string) Option {
+	return func(q *QuoteDB) {
+		prefix = path.Clean("/" + prefix)
+		if prefix == "/" {
+			prefix = ""
+		}
+		q.basePath = prefix
+	}
+}
+
+// WithDateFormat changes how the web page shows dates, the fmtDate template
+// function formats them with layout in loc. An empty layout keeps the
+// default of 2006-01-02 15:04:05 and a nil loc keeps UTC. Dates are always
+// stored in UTC.
+func WithDateFormat(layout string, loc *time.Location) Option {
+	return func(q *QuoteDB) {
+		q.dateLayout = layout
+		q.dateLocation = loc
+	}
+}
+
+// WithStaticDir serves the files in dir under /static/ so a custom template
+// can link to stylesheets, scripts and images. Files in dir also take the
+// place of the built in ones like favicon.ico. Static files do not require
+// basic auth.
+func WithStaticDir(dir string) Option {
+	return func(q *QuoteDB) {
+		q.staticDir = dir
+	}
+}
+
+// WithViewTracking makes IncrementView count views of quotes, the web page
+// counts a view whenever a quote's own page is shown. Views are kept in
+// memory and written every flushEvery to avoid a write on every view, a
+// flushEvery of 0 writes each view immediately.
+func WithViewTracking(flushEvery time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.trackViews = true
+		q.viewFlushEvery = flushEvery
+	}
+}
+
+// WithAutoCheckpoint runs Checkpoint in TRUNCATE mode every interval until
+// the QuoteDB is closed, so the -wal file can't keep growing while the
+// database is busy enough that SQLite's own checkpoints don't finish.
+func WithAutoCheckpoint(every time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.checkpointEvery = every
+	}
+}
+
+// WithGzip compresses the web server's responses for clients that accept
+// gzip, responses under 1KB are left alone.
+func WithGzip() Option {
+	return func(q *QuoteDB) {
+		q.gzip = true
+	}
+}
+
+// WithSessions lets browsers log in once at /login rather than sending basic
+// auth with every request, the session cookie is valid for ttl or until
+// /logout. Basic auth keeps working alongside it. The cookie is signed with
+// a secret generated when the database is opened, so sessions end when the
+// process restarts unless WithSessionSecret is used.
+func WithSessions(ttl time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.sessionTTL = ttl
+	}
+}
+
+// WithSessionSecret sets the secret session cookies are signed with, see
+// WithSessions. It must be kept private, anyone that knows it can create
+// sessions.
+func WithSessionSecret(secret []byte) Option {
+	return func(q *QuoteDB) {
+		q.sessionSecret = secret
+	}
+}
+
+// WithAccessLog logs every request the web server handles with its status,
+// size and duration. It's logged with the logger's Info method if it has
+// one, like *slog.Logger, otherwise with Error.
+func WithAccessLog() Option {
+	return func(q *QuoteDB) {
+		q.accessLog = true
+	}
+}
+
+// WithBcryptCost sets the bcrypt cost used to hash the web password, the
+// default is bcrypt.DefaultCost.
+func WithBcryptCost(cost int) Option {
+	return func(q *QuoteDB) {
+		q.webcost = cost
+	}
+}
+
+// WithJournalMode sets the sqlite journal mode used by OpenDB, the default is
+// WAL. WAL lets readers continue while a write is in progress which avoids
+// most "database is locked" errors when several writers share the database,
+// but it keeps two extra files (-wal and -shm) next to the database that
+// belong to it while it's open. Use "DELETE" for sqlite's classic single file
+// behavior or "" to leave the mode the database already has.
+func WithJournalMode(mode string) Option {
+	return func(q *QuoteDB) {
+		q.journalMode = mode
+	}
+}
+
+// WithBusyTimeout sets how long OpenDB's connections wait on a locked
+// database before giving up with an error, the default is 5 seconds. A
+// timeout of 0 fails immediately.
+func WithBusyTimeout(timeout time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.busyTimeout = timeout
+	}
+}
+
+// WithMaxOpenConns limits the connections OpenDB's pool may open, the default
+// of 0 is unlimited. In WAL mode many readers and a single writer can work at
+// once so there's little reason to limit it. Without WAL a limit of 1 avoids
+// lock errors at the cost of serializing every query.
+func WithMaxOpenConns(n int) Option {
+	return func(q *QuoteDB) {
+		q.maxOpenConns = n
+	}
+}
+
+// WithAuthorNormalization makes AddQuote store authors as NormalizeAuthor
+// returns them so differently cased or spaced names are the same author.
+// Existing quotes are left alone, see NormalizeAllAuthors.
+func WithAuthorNormalization() Option {
+	return func(q *QuoteDB) {
+		q.normalizeAuthors = true
+	}
+}
+
+// WithAuthorTrimming makes AddQuote store authors as TrimAuthor returns them,
+// like WithAuthorNormalization but keeping the casing the author was given
+// with. WithAuthorNormalization wins if both are given.
+func WithAuthorTrimming() Option {
+	return func(q *QuoteDB) {
+		q.trimAuthors = true
+	}
+}
+
+// WithAnonymousVoting lets the web page vote without basic auth configured,
+// each voter is identified by HashVoter(salt, ip). The salt must be kept the
+// same across restarts, see HashVoter.
+func WithAnonymousVoting(salt string) Option {
+	return func(q *QuoteDB) {
+		q.voterSalt = salt
+	}
+}
+
+// WithVoteWeight makes each vote count for weight(voter) instead of 1, for
+// example to give trusted users more say. The weight is stored with the vote
+// when it's cast so changing it later does not affect existing votes.
+// Weights less than 1 are treated as 1.
+func WithVoteWeight(weight func(voter string) int) Option {
+	return func(q *QuoteDB) {
+		q.voteWeight = weight
+	}
+}
+
+// ContentFilter is given the text of a new quote and returns the text to
+// store instead, like with banned words replaced by asterisks, or reject as
+// true if the quote must not be added at all.
+type ContentFilter func(text string) (filtered string, reject bool)
+
+// WithContentFilter runs filter on the text of every quote before it's
+// added, quotes it rejects fail with ErrRejectedContent. When filterAuthors
+// is true the author is put through filter as well. Quotes that were added
+// before the filter was set are left as they are.
+func WithContentFilter(filter ContentFilter, filterAuthors bool) Option {
+	return func(q *QuoteDB) {
+		q.contentFilter = filter
+		q.filterAuthors = filterAuthors
+	}
+}
+
+// WithEventHandler calls fn with an Event after a quote is added or a vote is
+// cast, for example to post new quotes to a chat. fn is run in its own
+// goroutine so a slow handler doesn't hold up the database, which also means
+// events may arrive in a different order than they happened.
+func WithEventHandler(fn func(Event)) Option {
+	return func(q *QuoteDB) {
+		q.onEvent = fn
+	}
+}
+
+// WithLogger sets where the web server logs its errors, by default they go
+// to the standard log package. A *slog.Logger satisfies Logger.
+func WithLogger(logger Logger) Option {
+	return func(q *QuoteDB) {
+		q.logger = logger
+	}
+}
+
+// WithServerTimeouts sets the timeouts of the http.Server created by
+// StartServer, a timeout of 0 means no timeout. The defaults are 10s to read
+// the request headers, 30s to read the whole request, 1m to write the
+// response (rendering every quote can take a while on big databases) and 2m
+// for idle keep-alive connections.
+func WithServerTimeouts(readHeader, read, write, idle time.Duration) Option {
+	return func(q *QuoteDB) {
+		q.readHeaderTimeout = readHeader
+		q.readTimeout = read
+		q.writeTimeout = write
+		q.idleTimeout = idle
+	}
+}
@@ -2,25 +2,33 @@ package quotes
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"errors"
 	"fmt"
+	"html/template"
+	"math"
+	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	// sqlite3
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Thresholds, it's in two different ones to avoid
-// having to define as var and use sprintf
-const (
-	quoteThreshold    = -2
-	quoteThresholdStr = "-2"
-)
+// DefaultThreshold is the visibility threshold unless WithThreshold changes
+// it, quotes scoring at or below it are hidden.
+const DefaultThreshold = -2
+
+// sqlThreshold stands in for the visibility threshold in queries, it's
+// replaced with the QuoteDB's threshold by withThreshold before they're run.
+const sqlThreshold = "{threshold}"
 
 const (
 	sqlCreateTable = `CREATE TABLE IF NOT EXISTS quotes (` +
@@ -35,118 +43,548 @@ const (
 		`date INTEGER NOT NULL,` +
 		`PRIMARY KEY (quote_id, voter),` +
 		`FOREIGN KEY (quote_id) REFERENCES quotes (id))`
+	sqlCreateEditsTable = `CREATE TABLE IF NOT EXISTS edits (` +
+		`id INTEGER PRIMARY KEY AUTOINCREMENT,` +
+		`quote_id INTEGER NOT NULL,` +
+		`quote TEXT NOT NULL,` +
+		`editor TEXT NOT NULL,` +
+		`date INTEGER NOT NULL,` +
+		`FOREIGN KEY (quote_id) REFERENCES quotes (id))`
 	sqlDateIndex        = `CREATE INDEX IF NOT EXISTS quotesdate ON quotes (date);`
 	sqlVoteQuoteIDIndex = `CREATE INDEX IF NOT EXISTS quotesid ON votes (quote_id);`
-	sqlVoteVoteIndex    = `CREATE INDEX IF NOT EXISTS votesvote ON votes (vote);`
-
-	sqlGetCount = `SELECT COUNT(*) FROM quotes;`
-	sqlAdd      = `INSERT INTO quotes (date, author, quote) VALUES(?, ?, ?);`
-	sqlDel      = `DELETE FROM quotes WHERE id = ?;`
-	sqlDelVotes = `DELETE FROM votes WHERE quote_id = ?;`
-	sqlEdit     = `UPDATE quotes SET quote = ? WHERE id = ?;`
-
-	sqlHasQuote = `SELECT EXISTS(SELECT id FROM quotes WHERE id = ?);`
-	sqlGetByID  = `SELECT id, date, author, quote, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = 1) AS upvotes, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = -1) AS downvotes ` +
-		`FROM quotes ` +
-		`WHERE id = ?;`
-	sqlGetRandom = `SELECT id, date, author, quote, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = 1) AS upvotes, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = -1) AS downvotes ` +
-		`FROM quotes ` +
-		`WHERE (upvotes - downvotes) > ` + quoteThresholdStr + ` ` +
+	sqlVoteVoteIndex    = `CREATE INDEX IF NOT EXISTS votesquotevote ON votes (quote_id, vote);`
+	sqlEditQuoteIDIndex = `CREATE INDEX IF NOT EXISTS editsquoteid ON edits (quote_id);`
+	// sqlAuthorQuoteIndex is only created when unique quotes per author are
+	// enabled, deleted quotes are left out so they don't block re-adding.
+	sqlAuthorQuoteIndex = `CREATE UNIQUE INDEX IF NOT EXISTS quotesauthorquote ON quotes (normalized_author, normalized_quote) WHERE deleted_at IS NULL;`
+
+	sqlCreateMigrationsTable = `CREATE TABLE IF NOT EXISTS migrations (` +
+		`version INTEGER PRIMARY KEY,` +
+		`date INTEGER NOT NULL);`
+	sqlHasMigration = `SELECT EXISTS(SELECT version FROM migrations WHERE version = ?);`
+	sqlAddMigration = `INSERT INTO migrations (version, date) VALUES (?, ?);`
+
+	sqlGetCount    = `SELECT COUNT(*) FROM quotes WHERE deleted_at IS NULL AND status = 'approved';`
+	sqlAdd         = `INSERT INTO quotes (date, author, quote, normalized_quote, normalized_author, source, status, collection, submitter) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	sqlFindDup     = `SELECT id FROM quotes WHERE normalized_quote = ? AND deleted_at IS NULL AND status != 'rejected' LIMIT 1;`
+	sqlDel         = `DELETE FROM quotes WHERE id = ?;`
+	sqlDelVotes    = `DELETE FROM votes WHERE quote_id = ?;`
+	sqlDelEdits    = `DELETE FROM edits WHERE quote_id = ?;`
+	sqlSoftDel     = `UPDATE quotes SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL;`
+	sqlRestore     = `UPDATE quotes SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL;`
+	sqlPurgeVotes  = `DELETE FROM votes WHERE quote_id IN (SELECT id FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?);`
+	sqlPurgeEdits  = `DELETE FROM edits WHERE quote_id IN (SELECT id FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?);`
+	sqlPurgeQuotes = `DELETE FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?;`
+	sqlEdit        = `UPDATE quotes SET author = ?, quote = ?, normalized_quote = ?, normalized_author = ? WHERE id = ? AND deleted_at IS NULL;`
+	sqlGetForEdit  = `SELECT author, quote, locked FROM quotes WHERE id = ? AND deleted_at IS NULL;`
+	sqlAddEdit     = `INSERT INTO edits (quote_id, author, quote, editor, date) VALUES (?, ?, ?, ?, ?);`
+	sqlGetEdits    = `SELECT quote_id, author, quote, editor, date FROM edits WHERE quote_id = ? ORDER BY date asc, id asc;`
+
+	// sqlFindAuthorDup excludes the quote being edited, it's 0 when adding.
+	sqlFindAuthorDup = `SELECT id FROM quotes WHERE normalized_author = ? AND normalized_quote = ? AND id != ? AND deleted_at IS NULL LIMIT 1;`
+
+	// sqlQuoteColumns is what every query returning quotes selects, in the
+	// order scanQuote expects. The quotes table must be aliased as q.
+	sqlQuoteColumns = `q.id, q.date, q.author, q.quote, q.source, q.collection, q.submitter, q.views, ` +
+		`q.upvotes, q.downvotes, q.locked, q.pinned_at IS NOT NULL `
+
+	// upvotes and downvotes are stored on the quote by the vote methods so
+	// they don't have to be summed up for every quote on every query, these
+	// recount them from the votes.
+	sqlCountUpvotes   = `(SELECT COALESCE(SUM(vote), 0) FROM votes WHERE quote_id = quotes.id AND vote > 0)`
+	sqlCountDownvotes = `(SELECT COALESCE(-SUM(vote), 0) FROM votes WHERE quote_id = quotes.id AND vote < 0)`
+	sqlRecountScore   = `UPDATE quotes SET upvotes = ` + sqlCountUpvotes + `, downvotes = ` + sqlCountDownvotes + ` WHERE id = ?;`
+	sqlRecountScores  = `UPDATE quotes SET upvotes = ` + sqlCountUpvotes + `, downvotes = ` + sqlCountDownvotes + `;`
+	sqlChangeScore    = `UPDATE quotes SET upvotes = upvotes + ?, downvotes = downvotes + ? WHERE id = ?;`
+
+	sqlHasQuote = `SELECT EXISTS(SELECT id FROM quotes WHERE id = ? AND deleted_at IS NULL AND status = 'approved');`
+	sqlGetByID  = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE id = ? AND deleted_at IS NULL AND status = 'approved';`
+	sqlGetByIDAnyStatus = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE id = ? AND deleted_at IS NULL;`
+	sqlGetByIDs = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE id IN (%s) AND deleted_at IS NULL AND status = 'approved';`
+	sqlGetRandomExcluding = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE id NOT IN (%s) AND deleted_at IS NULL AND status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
 		`ORDER BY RANDOM() LIMIT 1;`
-	sqlGetAll = `SELECT q.id, q.date, q.author, q.quote, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = 1) AS upvotes, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = -1) AS downvotes ` +
-		`FROM quotes as q ` +
+	sqlGetRandom = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE deleted_at IS NULL AND status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY RANDOM() LIMIT 1;`
+	sqlGetRandomIn = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE deleted_at IS NULL AND status = 'approved' AND collection = ? AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY RANDOM() LIMIT 1;`
+	sqlGetRandomAll = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE deleted_at IS NULL AND status = 'approved' ` +
+		`ORDER BY RANDOM() LIMIT 1;`
+	sqlGetRandomN = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE deleted_at IS NULL AND status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY RANDOM() LIMIT ?;`
+	// sqlPinnedFirst starts the order by clauses of the lists that show
+	// pinned quotes first.
+	sqlPinnedFirst = `q.pinned_at IS NULL, q.pinned_at desc, `
+	// sqlGetAll and sqlGetAllFiltered are completed with an order by clause
+	// from allOrders.
+	sqlGetAll = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' `
+	sqlGetAllFiltered = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` `
+	sqlCountAll         = `SELECT COUNT(*) FROM quotes as q WHERE q.deleted_at IS NULL AND q.status = 'approved';`
+	sqlCountAllFiltered = `SELECT COUNT(*) FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + `;`
+	// sqlGetAllIn and sqlGetAllInFiltered are completed like sqlGetAll.
+	sqlGetAllIn = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.collection = ? `
+	sqlGetAllInFiltered = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.collection = ? AND (upvotes - downvotes) > ` + sqlThreshold + ` `
+	sqlGetMinVotes = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes + downvotes) >= ? ` +
+		`ORDER BY q.id desc;`
+	sqlGetMinVotesFiltered = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes + downvotes) >= ? AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
 		`ORDER BY q.id desc;`
-	sqlGetAllFiltered = `SELECT q.id, q.date, q.author, q.quote, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = 1) AS upvotes, ` +
-		`(SELECT COUNT(*) FROM votes WHERE quote_id = id AND vote = -1) AS downvotes ` +
-		`FROM quotes as q ` +
-		`WHERE (upvotes - downvotes) > ` + quoteThresholdStr + ` ` +
+	sqlGetRecent = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY q.date desc, q.id desc LIMIT ?;`
+	sqlGetSince = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.date > ? AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY q.date asc, q.id asc;`
+	sqlGetBefore = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.id < ? ` +
+		`ORDER BY q.id desc LIMIT ?;`
+	sqlGetBeforeFiltered = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.id < ? AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY q.id desc LIMIT ?;`
+	sqlGetByDateRange = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.date >= ? AND q.date < ? ` +
+		`ORDER BY q.date desc, q.id desc;`
+	sqlGetByDateRangeFiltered = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.date >= ? AND q.date < ? AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY q.date desc, q.id desc;`
+	sqlGetTrending = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`INNER JOIN (SELECT quote_id, SUM(vote) AS score FROM votes WHERE date >= ? GROUP BY quote_id) AS r ` +
+		`ON r.quote_id = q.id ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY r.score desc, q.id desc LIMIT ?;`
+	sqlGetByAuthor = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.author = ? ` +
 		`ORDER BY q.id desc;`
+	sqlGetByAuthorFiltered = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND q.author = ? AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY q.id desc;`
+	sqlGetTop = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY (upvotes - downvotes) desc, q.id desc LIMIT ?;`
+	sqlGetBottom = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' ` +
+		`ORDER BY (upvotes - downvotes) asc, q.id desc LIMIT ?;`
+
+	// votes.vote holds the signed weight of the vote, sqlHasVote and
+	// sqlGetVoterVotes reduce it back to a direction of 1 or -1.
+	sqlGetVoteWeight = `SELECT vote FROM votes WHERE quote_id = ? AND voter = ?;`
+	sqlHasVote       = `SELECT CASE WHEN vote > 0 THEN 1 ELSE -1 END FROM VOTES WHERE quote_id = ? AND voter = ? LIMIT 1;`
+	sqlVote          = `INSERT INTO votes (quote_id, voter, vote, date) VALUES (?, ?, ?, ?) ON CONFLICT (quote_id, voter) DO NOTHING;`
+	sqlUnvote        = `DELETE FROM VOTES WHERE quote_id = ? AND voter = ?;`
+	sqlGetUpvotes    = `SELECT COALESCE(SUM(vote), 0) FROM votes WHERE quote_id = ? AND vote > 0;`
+	sqlGetDownvotes  = `SELECT COALESCE(-SUM(vote), 0) FROM votes WHERE quote_id = ? AND vote < 0;`
+	sqlGetVoteCount  = `SELECT COUNT(*) FROM votes;`
+	sqlGetVoterVotes = `SELECT quote_id, CASE WHEN vote > 0 THEN 1 ELSE -1 END FROM votes WHERE voter = ?;`
+	sqlGetVotedBy    = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`INNER JOIN votes as v ON v.quote_id = q.id ` +
+		`WHERE v.voter = ? AND q.deleted_at IS NULL AND q.status = 'approved' %s` +
+		`ORDER BY v.date desc, q.id desc;`
+
+	sqlGetVotesBatch = `SELECT quote_id, ` +
+		`SUM(CASE WHEN vote > 0 THEN vote ELSE 0 END), ` +
+		`SUM(CASE WHEN vote < 0 THEN -vote ELSE 0 END) ` +
+		`FROM votes WHERE quote_id IN (%s) GROUP BY quote_id;`
+)
 
-	sqlHasVote      = `SELECT vote FROM VOTES WHERE quote_id = ? AND voter = ? LIMIT 1;`
-	sqlUpvote       = `INSERT INTO votes (quote_id, voter, vote, date) VALUES (?, ?, 1, ?);`
-	sqlDownvote     = `INSERT INTO votes (quote_id, voter, vote, date) VALUES (?, ?, -1, ?);`
-	sqlUnvote       = `DELETE FROM VOTES WHERE quote_id = ? AND voter = ?;`
-	sqlGetUpvotes   = `SELECT COUNT(*) FROM votes WHERE quote_id = ? AND vote = 1;`
-	sqlGetDownvotes = `SELECT COUNT(*) FROM votes WHERE quote_id = ? AND vote = -1;`
+var (
+	// ErrDuplicate is returned by AddQuote when unique quotes are enabled and
+	// the quote already exists.
+	ErrDuplicate = errors.New("quote already exists")
+	// ErrAlreadyReported is returned by ReportQuote when the reporter has
+	// already reported the quote.
+	ErrAlreadyReported = errors.New("quote already reported")
+	// ErrNoQuotes is returned when there are no quotes eligible to be picked.
+	ErrNoQuotes = errors.New("no quotes")
+	// ErrQuoteNotFound is returned when the quote being changed does not
+	// exist.
+	ErrQuoteNotFound = errors.New("quote not found")
+	// ErrRateLimited is returned when a voter has voted too often recently,
+	// or when too many quotes by the same author were added recently.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrInvalidQuote is wrapped by the *ValidationError returned when a
+	// quote can't be added as it is, like when it's empty.
+	ErrInvalidQuote = errors.New("invalid quote")
+	// ErrQuoteLocked is returned when editing a quote that's locked, see
+	// LockQuote.
+	ErrQuoteLocked = errors.New("quote is locked")
+	// ErrRejectedContent is returned when a quote is rejected by the
+	// ContentFilter, see WithContentFilter.
+	ErrRejectedContent = errors.New("quote rejected by content filter")
+	// ErrCheckpointBusy is returned by Checkpoint when other connections kept
+	// it from finishing.
+	ErrCheckpointBusy = errors.New("checkpoint did not finish, the database is busy")
+	// ErrDatabase is wrapped by every error that comes from the database
+	// itself, like a bad connection or a missing file, so they can be told
+	// apart from errors like ErrQuoteNotFound with errors.Is.
+	ErrDatabase = errors.New("database error")
 )
 
 // QuoteDB provides file storage of quotes via an sqlite database.
 type QuoteDB struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts stmts
 
+	// webpass is only kept until it's been hashed into webhash when the
+	// database is opened.
+	webauth bool
 	webuser string
 	webpass string
 	webhash []byte
+	webcost int
+
+	sessionTTL    time.Duration
+	sessionSecret []byte
+
+	softDelete       bool
+	uniqueQuotes     bool
+	uniquePerAuthor  bool
+	moderation       bool
+	normalizeAuthors bool
+	trimAuthors      bool
+	threshold        int
+	maxQuoteLen      int
+	voterSalt        string
+	logger           Logger
+	voteLimiter      *rateLimiter
+	addLimiter       *rateLimiter
+	contentFilter    ContentFilter
+	filterAuthors    bool
+	markdown         bool
+	autoLock         int
+	allowedNets      []*net.IPNet
+	trustProxy       bool
+	voteWeight       func(voter string) int
+	onEvent          func(Event)
+	tmpl             *template.Template
+	dateLayout       string
+	dateLocation     *time.Location
+	staticDir        string
+	basePath         string
+	gzip             bool
+	accessLog        bool
+	trackViews       bool
+	viewFlushEvery   time.Duration
+	views            viewCounter
+	checkpointEvery  time.Duration
+	checkpoints      checkpointer
+
+	journalMode  string
+	busyTimeout  time.Duration
+	maxOpenConns int
+
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
 
 	sync.RWMutex
 	nQuotes int
+
+	// counters for metrics, guarded by the same lock as nQuotes
+	nAdded   uint64
+	nVoted   uint64
+	nDeleted uint64
 }
 
 // Quote is for serializing to and from the sqlite database.
 type Quote struct {
-	ID     int
-	Date   time.Time
-	Author string
-	Quote  string
+	ID     int       `json:"id"`
+	Date   time.Time `json:"date"`
+	Author string    `json:"author"`
+	Quote  string    `json:"quote"`
+	Source string    `json:"source,omitempty"`
+	// Collection is empty for quotes that were not added to one, see
+	// AddQuoteIn.
+	Collection string `json:"collection,omitempty"`
+	// Submitter is who added the quote, empty unless it was added with
+	// AddQuoteBy.
+	Submitter string `json:"submitter,omitempty"`
+
+	Upvotes   int `json:"upvotes"`
+	Downvotes int `json:"downvotes"`
+	// Views is only counted when view tracking is enabled.
+	Views int `json:"views"`
+	// Locked quotes can't be edited, see LockQuote.
+	Locked bool `json:"locked,omitempty"`
+	// Pinned quotes are listed before the others, see Pin.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Confidence is only filled in by RankByConfidence.
+	Confidence float64 `json:"confidence,omitempty"`
+	// Hotness is only filled in by HotRank.
+	Hotness float64 `json:"hotness,omitempty"`
+}
+
+// Length is the number of characters in the quote text, a multibyte
+// character like an emoji counts as one.
+func (q Quote) Length() int {
+	return utf8.RuneCountInString(q.Quote)
+}
+
+// WordCount is the number of whitespace separated words in the quote text.
+func (q Quote) WordCount() int {
+	return len(strings.Fields(q.Quote))
+}
+
+// Direction is which way a vote goes. Votes are stored with their weight,
+// the direction is its sign.
+type Direction int
+
+// The vote directions.
+const (
+	Down Direction = -1
+	None Direction = 0
+	Up   Direction = 1
+)
+
+// valid reports whether d is one of the vote directions.
+func (d Direction) valid() bool {
+	return d == Down || d == None || d == Up
+}
 
-	Upvotes   int
-	Downvotes int
+// Edit is a single change made to a quote, Author and Quote hold the quote
+// as it was before the edit was made. Author is empty for edits made before
+// authors could be edited.
+type Edit struct {
+	QuoteID int
+	Author  string
+	Quote   string
+	Editor  string
+	Date    time.Time
 }
 
-// OpenDB opens the database at the location requested.
-func OpenDB(filename, webAuth string) (*QuoteDB, error) {
+// OpenDB opens the database at the location requested, see Config.Filename
+// for what it may be. By default the database is put in WAL mode with a busy
+// timeout, see WithJournalMode and WithBusyTimeout. It's shorthand for
+// OpenWithConfig.
+//
+// The driver parameters _foreign_keys=1, _txlock=immediate, _journal_mode
+// and _busy_timeout are added to filename. Any of them filename already has
+// is kept as it is rather than overridden, so turning off foreign keys or
+// deferred transactions that way is up to the caller.
+func OpenDB(filename, webAuth string, options ...Option) (*QuoteDB, error) {
+	return OpenWithConfig(Config{
+		Filename: filename,
+		WebAuth:  webAuth,
+		Options:  options,
+	})
+}
+
+// memoryDBs numbers the databases created by OpenMemoryDB so each one is
+// separate.
+var memoryDBs uint64
+
+// OpenMemoryDB opens a new empty database that only exists in memory, it's
+// primarily meant for tests. The database is gone once it's closed. Its
+// queries all share a single connection, so the fn given to ForEachQuote
+// must not use the QuoteDB.
+func OpenMemoryDB(webAuth string, options ...Option) (*QuoteDB, error) {
+	return newQuoteDB(webAuth, options).openMemory()
+}
+
+// openMemory opens a new private in-memory database. It's shared by the
+// connections of the pool, a plain :memory: database would be a different
+// one for every connection.
+func (q *QuoteDB) openMemory() (*QuoteDB, error) {
+	name := fmt.Sprintf("file:quotes-memory-%d", atomic.AddUint64(&memoryDBs, 1))
 	opts := make(url.Values)
+	opts.Set("mode", "memory")
+	opts.Set("cache", "shared")
+
+	return q.openSQLite(name, opts)
+}
+
+// openSQLite opens filename with the sqlite3 driver, opts are added to the
+// connection string alongside those controlled by options unless filename
+// already sets them, see sqliteDSN.
+func (q *QuoteDB) openSQLite(filename string, opts url.Values) (*QuoteDB, error) {
 	opts.Set("_foreign_keys", "1")
+	opts.Set("_txlock", "immediate")
+	if len(q.journalMode) != 0 {
+		opts.Set("_journal_mode", q.journalMode)
+	}
+	opts.Set("_busy_timeout", strconv.FormatInt(q.busyTimeout.Milliseconds(), 10))
 
-	var user, pass string
-	var hash []byte
-	if len(webAuth) != 0 {
-		splits := strings.SplitN(webAuth, ":", 2)
-		if len(splits) == 2 {
-			user = splits[0]
-			pass = splits[1]
-
-			var err error
-			hash, err = bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
-			if err != nil {
-				return nil, fmt.Errorf("failed to bcrypt web password: %w", err)
-			}
-		}
+	dsn, err := sqliteDSN(filename, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", filename+`?`+opts.Encode())
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
+		return nil, dbError(err)
+	}
+	if memoryDSN(dsn) {
+		// Connections to a shared cache lock whole tables and fail with
+		// SQLITE_LOCKED rather than waiting out the busy timeout, and without
+		// one every connection has its own database. Either way only a single
+		// connection works, whatever WithMaxOpenConns says.
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(q.maxOpenConns)
+	}
+
+	q.db = db
+	if err = q.setup(); err != nil {
 		return nil, err
 	}
 
-	qdb := &QuoteDB{
-		db:      db,
-		webuser: user,
-		webpass: pass,
-		webhash: hash,
+	return q, nil
+}
+
+// sqliteDSN adds opts to the query string of filename, which can be a plain
+// path or a file: uri that may already have a query string. Parameters the
+// filename already has are kept as they are. Like the sqlite3 driver, a ?
+// always starts the query string, a path containing one must be given as a
+// file: uri with it escaped as %3f.
+func sqliteDSN(filename string, opts url.Values) (string, error) {
+	name, query, _ := strings.Cut(filename, "?")
+	if len(name) == 0 {
+		return "", errors.New("no database filename")
 	}
 
-	err = qdb.createTable()
+	params, err := url.ParseQuery(query)
 	if err != nil {
-		defer qdb.Close()
-		return nil, err
+		return "", fmt.Errorf("invalid parameters in database filename %q: %w", filename, err)
 	}
-	err = qdb.getCount()
+	for k, v := range opts {
+		if _, ok := params[k]; !ok {
+			params[k] = v
+		}
+	}
+
+	return name + "?" + params.Encode(), nil
+}
+
+// memoryDSN reports whether dsn opens an in-memory database.
+func memoryDSN(dsn string) bool {
+	name, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
 	if err != nil {
-		defer qdb.Close()
+		return false
+	}
+	return name == ":memory:" || name == "file::memory:" || params.Get("mode") == "memory"
+}
+
+// OpenDBWith wraps an already opened database handle, which allows the
+// caller to pick the driver and DSN. The tables are created if necessary.
+// The returned QuoteDB takes ownership of db and closes it in Close.
+//
+// The queries are written for sqlite3 and rely on ? placeholders, the
+// AUTOINCREMENT keyword, RANDOM() and sql.Result.LastInsertId, so the driver
+// must support those (or an equivalent) for every method to work. Foreign key
+// enforcement is the responsibility of whoever opened db.
+func OpenDBWith(db *sql.DB, webAuth string, options ...Option) (*QuoteDB, error) {
+	qdb := newQuoteDB(webAuth, options)
+	qdb.db = db
+	if err := qdb.setup(); err != nil {
 		return nil, err
 	}
 
 	return qdb, nil
 }
 
+// newQuoteDB creates a QuoteDB with the options applied but no database.
+func newQuoteDB(webAuth string, options []Option) *QuoteDB {
+	qdb := &QuoteDB{
+		webcost:     bcrypt.DefaultCost,
+		logger:      stdLogger{},
+		journalMode: "WAL",
+		busyTimeout: 5 * time.Second,
+		threshold:   DefaultThreshold,
+		maxQuoteLen: maxQuoteLength,
+
+		readHeaderTimeout: 10 * time.Second,
+		readTimeout:       30 * time.Second,
+		writeTimeout:      time.Minute,
+		idleTimeout:       2 * time.Minute,
+	}
+
+	if splits := strings.SplitN(webAuth, ":", 2); len(splits) == 2 {
+		qdb.webauth = true
+		qdb.webuser = splits[0]
+		qdb.webpass = splits[1]
+	}
+
+	for _, o := range options {
+		o(qdb)
+	}
+
+	return qdb
+}
+
+// setup creates the tables and counts the quotes of a freshly opened
+// database, the database is closed if it fails.
+func (q *QuoteDB) setup() error {
+	if q.webauth {
+		if err := q.hashWebPass(); err != nil {
+			defer q.Close()
+			return err
+		}
+	}
+
+	for _, limiter := range []*rateLimiter{q.voteLimiter, q.addLimiter} {
+		if err := limiter.validate(); err != nil {
+			defer q.Close()
+			return err
+		}
+	}
+
+	err := q.createTable()
+	if err != nil {
+		defer q.Close()
+		return err
+	}
+	err = q.migrate()
+	if err != nil {
+		defer q.Close()
+		return err
+	}
+	if q.uniquePerAuthor {
+		if _, err = q.db.Exec(sqlAuthorQuoteIndex); err != nil {
+			defer q.Close()
+			return fmt.Errorf("failed to create unique author quote index, "+
+				"existing duplicates must be removed first: %w", dbError(err))
+		}
+	}
+	err = q.getCount()
+	if err != nil {
+		defer q.Close()
+		return err
+	}
+
+	if err = q.setupTemplate(); err != nil {
+		defer q.Close()
+		return err
+	}
+
+	if q.sessionTTL > 0 && len(q.sessionSecret) == 0 {
+		q.sessionSecret = make([]byte, 32)
+		if _, err = rand.Read(q.sessionSecret); err != nil {
+			defer q.Close()
+			return fmt.Errorf("failed to generate session secret: %w", err)
+		}
+	}
+
+	q.prepare()
+	q.startViewFlusher()
+	q.startCheckpointer()
+	return nil
+}
+
 // NQuotes returns the number of quotes in the database.
 func (q *QuoteDB) NQuotes() int {
 	q.RLock()
@@ -159,200 +597,1047 @@ func (q *QuoteDB) createTable() (err error) {
 	var commands = []string{
 		sqlCreateTable,
 		sqlCreateVotesTable,
+		sqlCreateEditsTable,
+		sqlCreateTagsTable,
+		sqlCreateReactionsTable,
+		sqlCreateFavoritesTable,
+		sqlCreateReportsTable,
 		sqlDateIndex,
 		sqlVoteQuoteIDIndex,
 		sqlVoteVoteIndex,
+		sqlEditQuoteIDIndex,
+		sqlTagIndex,
+		sqlFavoriteQuoteIDIndex,
+		sqlCreateMigrationsTable,
 	}
 
 	for _, c := range commands {
 		_, err = q.db.Exec(c)
 		if err != nil {
-			return fmt.Errorf("error running sql statement:\nsql: %s\nerror: %v", c, err)
+			return fmt.Errorf("error running sql statement:\nsql: %s\nerror: %w", c, dbError(err))
 		}
 	}
 
 	return nil
 }
 
+// normalizeQuote trims the quote and collapses runs of whitespace so that
+// trivially different copies of the same quote compare equal.
+func normalizeQuote(quote string) string {
+	return strings.Join(strings.Fields(quote), " ")
+}
+
 // getCount refreshes the number of quotes.
 func (q *QuoteDB) getCount() error {
-	return q.db.QueryRow(sqlGetCount).Scan(&q.nQuotes)
+	return dbError(q.db.QueryRow(sqlGetCount).Scan(&q.nQuotes))
+}
+
+// RefreshCount recounts the quotes in the database, this is useful if other
+// processes share the database since NQuotes only tracks changes made
+// through this QuoteDB.
+func (q *QuoteDB) RefreshCount() error {
+	q.Lock()
+	defer q.Unlock()
+	return q.getCount()
 }
 
 // Close the database file.
 func (q *QuoteDB) Close() error {
+	if err := q.stopViewFlusher(); err != nil {
+		q.logger.Error("Failed to flush views", "err", err)
+	}
+	q.stopCheckpointer()
+
+	serr := q.stmts.close()
 	err := q.db.Close()
 	q.db = nil
+	if err == nil {
+		err = serr
+	}
+	return dbError(err)
+}
+
+// DB returns the underlying database so custom queries, like reports, can
+// share the connection pool rather than opening the file again. It's for
+// advanced use only: writing to the tables behind the QuoteDB's back leaves
+// NQuotes stale (see RefreshCount) and can break assumptions of its
+// methods. ReadTx is a safer way to run read only queries.
+func (q *QuoteDB) DB() *sql.DB {
+	return q.db
+}
+
+// ReadTx runs fn in a transaction on the QuoteDB's connection pool that's
+// always rolled back once fn returns, so nothing fn writes is kept. The
+// error from fn is returned as is. OpenDB's transactions take the write
+// lock when they begin, so fn should be quick.
+func (q *QuoteDB) ReadTx(fn func(tx *sql.Tx) error) error {
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return dbError(err)
+	}
+
+	err = fn(tx)
+	if rerr := tx.Rollback(); rerr != nil && err == nil {
+		return dbError(rerr)
+	}
 	return err
 }
 
-// AddQuote adds a quote to the database.
+// AddQuote adds a quote to the database. When unique quotes are enabled and
+// a quote with the same normalized text exists its id is returned along with
+// ErrDuplicate, likewise when unique quotes per author are enabled and the
+// same author already has that quote. When moderation is enabled the quote
+// stays hidden until it's approved, see WithModeration. Empty or overly long
+// quotes are rejected with a *ValidationError, which is new: earlier
+// versions stored them and callers that relied on it must handle the error.
 func (q *QuoteDB) AddQuote(author, quote string) (id int64, err error) {
+	stored, err := q.addQuote("", author, quote, "", "", time.Now())
+	return int64(stored.ID), err
+}
+
+// AddQuoteIn adds a quote like AddQuote to a named collection, see
+// GetAllIn for what collections do and don't keep apart. Quotes added
+// without a collection are in the collection "".
+func (q *QuoteDB) AddQuoteIn(collection, author, quote string) (int64, error) {
+	stored, err := q.addQuote(collection, author, quote, "", "", time.Now())
+	return int64(stored.ID), err
+}
+
+// AddQuoteBy adds a quote like AddQuote and records who submitted it, which
+// is often someone other than the author being quoted.
+func (q *QuoteDB) AddQuoteBy(author, quote, submitter string) (int64, error) {
+	stored, err := q.addQuote("", author, quote, "", submitter, time.Now())
+	return int64(stored.ID), err
+}
+
+// AddQuoteWithSource adds a quote like AddQuote and records where it came
+// from, typically a url.
+func (q *QuoteDB) AddQuoteWithSource(author, quote, source string) (int64, error) {
+	stored, err := q.addQuote("", author, quote, source, "", time.Now())
+	return int64(stored.ID), err
+}
+
+// AddQuoteReturning adds a quote like AddQuote but returns the stored quote
+// rather than only its id.
+func (q *QuoteDB) AddQuoteReturning(author, quote string) (Quote, error) {
+	stored, err := q.addQuote("", author, quote, "", "", time.Now())
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return stored, nil
+}
+
+// addQuote inserts a quote into collection with the given date. It returns
+// the quote as it was stored, after the content filter and author rules, or
+// only its id along with ErrDuplicate.
+func (q *QuoteDB) addQuote(collection, author, quote, source, submitter string, date time.Time) (stored Quote, err error) {
+	if author, quote, err = q.filterContent(author, quote); err != nil {
+		return Quote{}, err
+	}
+	if err = q.validateQuote(author, quote); err != nil {
+		return Quote{}, err
+	}
+
 	q.Lock()
 	defer q.Unlock()
 
-	var res sql.Result
-	res, err = q.db.Exec(sqlAdd, time.Now().Unix(), author, quote)
+	author = q.storedAuthor(author)
+	limitKey := NormalizeAuthor(author)
+	if !q.addLimiter.allow(limitKey) {
+		return Quote{}, ErrRateLimited
+	}
+
+	id, err := q.insertQuote(q.db, collection, author, quote, source, submitter, date)
 	if err != nil {
-		return
+		// Only quotes that are added count towards the limit.
+		q.addLimiter.refund(limitKey)
+		return Quote{ID: int(id)}, err
 	}
 
-	if id, err = res.LastInsertId(); err != nil {
-		id = 0
+	stored = Quote{
+		ID:         int(id),
+		Date:       time.Unix(date.Unix(), 0).UTC(),
+		Author:     author,
+		Quote:      quote,
+		Source:     source,
+		Collection: collection,
+		Submitter:  submitter,
 	}
 
+	q.nAdded++
+	if q.moderation {
+		// The event is sent once a moderator approves the quote.
+		return stored, nil
+	}
 	q.nQuotes++
-	return
+
+	q.emit(Event{Type: QuoteAdded, Quote: stored})
+	return stored, nil
+}
+
+// filterContent puts the quote, and the author when asked to, through the
+// ContentFilter. It returns ErrRejectedContent if either is rejected.
+func (q *QuoteDB) filterContent(author, quote string) (string, string, error) {
+	if q.contentFilter == nil {
+		return author, quote, nil
+	}
+
+	quote, reject := q.contentFilter(quote)
+	if reject {
+		return "", "", ErrRejectedContent
+	}
+	if q.filterAuthors {
+		if author, reject = q.contentFilter(author); reject {
+			return "", "", ErrRejectedContent
+		}
+	}
+
+	return author, quote, nil
+}
+
+// execQuerier is the part of *sql.DB and *sql.Tx that insertQuote uses.
+type execQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
-// RandomQuote gets a random existing quote.
+// insertQuote checks the quote for duplicates and inserts it with db, the
+// author must already be the stored author. The id of the existing quote is
+// returned along with ErrDuplicate when it's a duplicate.
+func (q *QuoteDB) insertQuote(db execQuerier, collection, author, quote, source, submitter string, date time.Time) (id int64, err error) {
+	normalized := normalizeQuote(quote)
+	normalizedAuthor := NormalizeAuthor(author)
+	if q.uniqueQuotes {
+		err = db.QueryRow(sqlFindDup, normalized).Scan(&id)
+		if err == nil {
+			return id, ErrDuplicate
+		} else if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("failed to check for duplicate quote: %w", dbError(err))
+		}
+	}
+	if q.uniquePerAuthor {
+		err = db.QueryRow(sqlFindAuthorDup, normalizedAuthor, normalized, 0).Scan(&id)
+		if err == nil {
+			return id, ErrDuplicate
+		} else if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("failed to check for duplicate quote: %w", dbError(err))
+		}
+	}
+
+	status := statusApproved
+	if q.moderation {
+		status = statusPending
+	}
+
+	res, err := db.Exec(sqlAdd, date.Unix(), author, quote, normalized, normalizedAuthor, source, status, collection, submitter)
+	if isUniqueViolation(err) {
+		// Another connection added the same quote since it was checked.
+		if err = db.QueryRow(sqlFindAuthorDup, normalizedAuthor, normalized, 0).Scan(&id); err != nil {
+			id = 0
+		}
+		return id, ErrDuplicate
+	} else if err != nil {
+		return 0, dbError(err)
+	}
+
+	if id, err = res.LastInsertId(); err != nil {
+		return 0, dbError(err)
+	}
+
+	return id, nil
+}
+
+// RandomQuote gets a random existing quote. Quotes below the visibility
+// threshold are never picked, see RandomQuoteIncludingHidden.
 func (q *QuoteDB) RandomQuote() (quote Quote, err error) {
-	var date int64
-	err = q.db.QueryRow(sqlGetRandom).Scan(
-		&quote.ID,
-		&date,
-		&quote.Author,
-		&quote.Quote,
-		&quote.Upvotes,
-		&quote.Downvotes)
-	if err != nil {
-		return quote, err
+	return scanQuote(q.queryRow(q.stmts.getRandom, sqlGetRandom))
+}
+
+// maxExcluded is how many of the ids passed to RandomQuoteExcluding are
+// honored, the last ones are kept.
+const maxExcluded = 500
+
+// RandomQuoteExcluding gets a random quote like RandomQuote that isn't one
+// of excludeIDs, like the quotes a user was recently shown. Once every
+// eligible quote is excluded the exclusion is ignored so a quote is still
+// returned. Only the last 500 ids are excluded.
+func (q *QuoteDB) RandomQuoteExcluding(excludeIDs []int) (quote Quote, err error) {
+	if len(excludeIDs) == 0 {
+		return q.RandomQuote()
+	}
+	if len(excludeIDs) > maxExcluded {
+		excludeIDs = excludeIDs[len(excludeIDs)-maxExcluded:]
 	}
 
-	quote.Date = time.Unix(date, 0).UTC()
+	args := make([]interface{}, len(excludeIDs))
+	for i, id := range excludeIDs {
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(sqlGetRandomExcluding, placeholders(len(excludeIDs)))
+	quote, err = scanQuote(q.db.QueryRow(q.withThreshold(query), args...))
+	if err == sql.ErrNoRows {
+		return q.RandomQuote()
+	}
 
 	return quote, err
 }
 
-// GetQuote gets a specific quote by id.
+// RandomQuoteIn gets a random quote like RandomQuote from a single
+// collection.
+func (q *QuoteDB) RandomQuoteIn(collection string) (quote Quote, err error) {
+	return scanQuote(q.db.QueryRow(q.withThreshold(sqlGetRandomIn), collection))
+}
+
+// RandomQuoteIncludingHidden gets a random quote like RandomQuote but picks
+// from every quote, including those below the visibility threshold. It's
+// for admin tooling.
+func (q *QuoteDB) RandomQuoteIncludingHidden() (quote Quote, err error) {
+	return scanQuote(q.db.QueryRow(sqlGetRandomAll))
+}
+
+// RandomQuotes gets up to n distinct random quotes, fewer are returned if
+// there aren't enough. Like RandomQuote, quotes below the visibility
+// threshold are never picked.
+func (q *QuoteDB) RandomQuotes(n int) ([]Quote, error) {
+	if n <= 0 {
+		return make([]Quote, 0), nil
+	}
+
+	return q.queryQuotes(sqlGetRandomN, n)
+}
+
+// GetQuote gets a specific quote by id. The visibility threshold doesn't
+// apply, quotes below it are returned like any other.
 func (q *QuoteDB) GetQuote(id int) (quote Quote, err error) {
-	var date int64
-	err = q.db.QueryRow(sqlGetByID, id).Scan(
-		&quote.ID,
-		&date,
-		&quote.Author,
-		&quote.Quote,
-		&quote.Upvotes,
-		&quote.Downvotes)
+	return scanQuote(q.queryRow(q.stmts.getByID, sqlGetByID, id))
+}
+
+// getQuoteAnyStatus gets a quote like GetQuote but whatever its moderation
+// status is.
+func (q *QuoteDB) getQuoteAnyStatus(id int) (quote Quote, err error) {
+	return scanQuote(q.db.QueryRow(sqlGetByIDAnyStatus, id))
+}
+
+// QuoteView is a quote as seen by a single voter, see GetQuoteFor.
+type QuoteView struct {
+	Quote
+	// MyVote is the voter's own vote on the quote.
+	MyVote Direction `json:"my_vote"`
+}
+
+// GetQuoteFor gets a quote like GetQuote along with the voter's vote on it.
+// It returns ErrQuoteNotFound if there is no such quote.
+func (q *QuoteDB) GetQuoteFor(id int, voter string) (QuoteView, error) {
+	quote, err := q.GetQuote(id)
+	if err == sql.ErrNoRows {
+		return QuoteView{}, ErrQuoteNotFound
+	} else if err != nil {
+		return QuoteView{}, err
+	}
+
+	vote, err := q.GetVote(id, voter)
+	if err != nil {
+		return QuoteView{}, err
+	}
+
+	return QuoteView{Quote: quote, MyVote: vote}, nil
+}
+
+// GetQuotes gets many quotes by id in a single query, or one query per
+// maxVariables ids, they're returned in the order of ids. Ids that don't
+// exist are left out rather than being an error and an id given more than
+// once is only returned once.
+func (q *QuoteDB) GetQuotes(ids []int) ([]Quote, error) {
+	byID := make(map[int]Quote, len(ids))
+	for remaining := ids; len(remaining) != 0; {
+		batch := remaining
+		if len(batch) > maxVariables {
+			batch = batch[:maxVariables]
+		}
+		remaining = remaining[len(batch):]
+
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		err := q.eachQuote(func(quote Quote) error {
+			byID[quote.ID] = quote
+			return nil
+		}, fmt.Sprintf(sqlGetByIDs, placeholders(len(batch))), args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	quotes := make([]Quote, 0, len(byID))
+	for _, id := range ids {
+		if quote, ok := byID[id]; ok {
+			quotes = append(quotes, quote)
+			delete(byID, id)
+		}
+	}
+
+	return quotes, nil
+}
+
+// DelQuote deletes a quote by id. When soft delete is enabled the quote is
+// only marked as deleted and can be brought back with RestoreQuote.
+func (q *QuoteDB) DelQuote(id int) (bool, error) {
+	if q.softDelete {
+		return q.softDelQuote(id)
+	}
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return false, dbError(err)
+	}
+
+	var res sql.Result
+	deleted := int64(0)
+	runTx := func() error {
+		if _, err = tx.Exec(sqlDelVotes, id); err != nil {
+			return fmt.Errorf("failed deleting quote votes: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelEdits, id); err != nil {
+			return fmt.Errorf("failed deleting quote edits: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelTags, id); err != nil {
+			return fmt.Errorf("failed deleting quote tags: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelReactions, id); err != nil {
+			return fmt.Errorf("failed deleting quote reactions: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelFavorites, id); err != nil {
+			return fmt.Errorf("failed deleting quote favorites: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlDelReports, id); err != nil {
+			return fmt.Errorf("failed deleting quote reports: %w", dbError(err))
+		}
+
+		if res, err = tx.Exec(sqlDel, id); err != nil {
+			return fmt.Errorf("failed deleting quote: %w", dbError(err))
+		}
+
+		if deleted, err = res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed getting rows affected: %w", dbError(err))
+		}
+
+		return nil
+	}
+
+	err = runTx()
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return false, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return false, fmt.Errorf("failed to delquote: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit delquote: %w", dbError(err))
+	}
+
+	if deleted != 1 {
+		return false, nil
+	}
+
+	q.Lock()
+	q.adjustCount(-1)
+	q.nDeleted++
+	q.Unlock()
+	return true, nil
+}
+
+// softDelQuote marks a quote as deleted without removing it or its votes.
+func (q *QuoteDB) softDelQuote(id int) (bool, error) {
+	res, err := q.db.Exec(sqlSoftDel, time.Now().Unix(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to soft delete quote: %w", dbError(err))
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed getting rows affected: %w", dbError(err))
+	}
+	if deleted != 1 {
+		return false, nil
+	}
+
+	q.Lock()
+	q.adjustCount(-1)
+	q.nDeleted++
+	q.Unlock()
+	return true, nil
+}
+
+// RestoreQuote brings back a soft deleted quote, it returns false if the
+// quote does not exist or was not deleted.
+func (q *QuoteDB) RestoreQuote(id int) (bool, error) {
+	res, err := q.db.Exec(sqlRestore, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore quote: %w", dbError(err))
+	}
+
+	restored, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed getting rows affected: %w", dbError(err))
+	}
+	if restored != 1 {
+		return false, nil
+	}
+
+	q.Lock()
+	q.adjustCount(1)
+	q.Unlock()
+	return true, nil
+}
+
+// PurgeDeleted permanently removes quotes (and their votes) that were soft
+// deleted before the given time. It returns the number of quotes removed.
+func (q *QuoteDB) PurgeDeleted(before time.Time) (int, error) {
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	var res sql.Result
+	purged := int64(0)
+	runTx := func() error {
+		if _, err = tx.Exec(sqlPurgeVotes, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quote votes: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlPurgeEdits, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quote edits: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlPurgeTags, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quote tags: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlPurgeReactions, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quote reactions: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlPurgeFavorites, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quote favorites: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlPurgeReports, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quote reports: %w", dbError(err))
+		}
+
+		if res, err = tx.Exec(sqlPurgeQuotes, before.Unix()); err != nil {
+			return fmt.Errorf("failed purging quotes: %w", dbError(err))
+		}
+
+		if purged, err = res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed getting rows affected: %w", dbError(err))
+		}
+
+		return nil
+	}
+
+	err = runTx()
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return 0, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return 0, fmt.Errorf("failed to purge deleted: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit purge deleted: %w", dbError(err))
+	}
+
+	return int(purged), nil
+}
+
+// EditQuote edits a quote by id, the previous text is recorded in the edit
+// history along with the editor. It returns ErrQuoteNotFound if there is no
+// such quote, setting the text it already has succeeds without recording an
+// edit. When unique quotes per author are enabled it returns ErrDuplicate
+// if the edit would make the quote a copy of another by the same author.
+// The new author and text go through the ContentFilter and are validated
+// like AddQuote's, failing with ErrRejectedContent or a *ValidationError.
+func (q *QuoteDB) EditQuote(id int, quote, editor string) (bool, error) {
+	return q.editQuote(id, editor, func(oldAuthor, _ string) (string, string) {
+		return oldAuthor, quote
+	})
+}
+
+// EditAuthor changes the author of a quote, for correcting misattributed
+// quotes. It's recorded in the edit history like EditQuote.
+func (q *QuoteDB) EditAuthor(id int, author, editor string) (bool, error) {
+	return q.editQuote(id, editor, func(_, oldQuote string) (string, string) {
+		return q.storedAuthor(author), oldQuote
+	})
+}
+
+// EditQuoteFull changes both the author and text of a quote in a single
+// edit, see EditQuote.
+func (q *QuoteDB) EditQuoteFull(id int, author, quote, editor string) (bool, error) {
+	return q.editQuote(id, editor, func(_, _ string) (string, string) {
+		return q.storedAuthor(author), quote
+	})
+}
+
+// editQuote replaces the author and text of a quote with what change returns
+// given the old ones, recording the old ones in the edit history.
+func (q *QuoteDB) editQuote(id int, editor string, change func(author, quote string) (string, string)) (bool, error) {
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
 	if err != nil {
-		return quote, err
+		return false, dbError(err)
+	}
+
+	runTx := func() error {
+		var oldAuthor, oldQuote string
+		var locked bool
+		err = tx.QueryRow(sqlGetForEdit, id).Scan(&oldAuthor, &oldQuote, &locked)
+		if err == sql.ErrNoRows {
+			return ErrQuoteNotFound
+		} else if err != nil {
+			return dbError(err)
+		}
+		if locked {
+			return ErrQuoteLocked
+		}
+
+		author, quote := change(oldAuthor, oldQuote)
+		if author == oldAuthor && quote == oldQuote {
+			return nil
+		}
+		if author, quote, err = q.filterContent(author, quote); err != nil {
+			return err
+		}
+		if err = q.validateQuote(author, quote); err != nil {
+			return err
+		}
+
+		normalized, normalizedAuthor := normalizeQuote(quote), NormalizeAuthor(author)
+		if q.uniquePerAuthor {
+			var dupID int
+			err = tx.QueryRow(sqlFindAuthorDup, normalizedAuthor, normalized, id).Scan(&dupID)
+			if err == nil {
+				return ErrDuplicate
+			} else if err != sql.ErrNoRows {
+				return fmt.Errorf("failed to check for duplicate quote: %w", dbError(err))
+			}
+		}
+
+		if _, err = tx.Exec(sqlEdit, author, quote, normalized, normalizedAuthor, id); isUniqueViolation(err) {
+			return ErrDuplicate
+		} else if err != nil {
+			return fmt.Errorf("failed updating quote: %w", dbError(err))
+		}
+
+		if _, err = tx.Exec(sqlAddEdit, id, oldAuthor, oldQuote, editor, time.Now().Unix()); err != nil {
+			return fmt.Errorf("failed recording edit: %w", dbError(err))
+		}
+
+		return nil
+	}
+
+	err = runTx()
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return false, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		var verr *ValidationError
+		if err == ErrQuoteNotFound || err == ErrDuplicate || err == ErrQuoteLocked || err == ErrRejectedContent || errors.As(err, &verr) {
+			return false, err
+		}
+		return false, fmt.Errorf("failed to edit quote: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit edit quote: %w", dbError(err))
+	}
+
+	return true, nil
+}
+
+// GetEditHistory returns the edits made to a quote, oldest first.
+func (q *QuoteDB) GetEditHistory(id int) ([]Edit, error) {
+	rows, err := q.db.Query(sqlGetEdits, id)
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	edits := make([]Edit, 0)
+	for rows.Next() {
+		var edit Edit
+		var date int64
+		if err = rows.Scan(&edit.QuoteID, &edit.Author, &edit.Quote, &edit.Editor, &date); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan edits (%w) but also close edits: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan edits: %w", dbError(err))
+		}
+
+		edit.Date = time.Unix(date, 0).UTC()
+
+		edits = append(edits, edit)
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing rows in get edit history: %w", dbError(err))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all edit rows: %w", dbError(err))
+	}
+
+	return edits, nil
+}
+
+// OrderBy is the order GetAllOrdered returns quotes in.
+type OrderBy int
+
+// Orders understood by GetAllOrdered, each orders descending and breaks ties
+// by id desc so the order is stable. Pinned quotes always come first, the
+// most recently pinned first.
+const (
+	// ByID orders by id, which is the order the quotes were added in.
+	ByID OrderBy = iota
+	// ByDate orders by the quote's date.
+	ByDate
+	// ByScore orders by upvotes minus downvotes.
+	ByScore
+)
+
+// allOrders maps the orders to their order by clauses.
+var allOrders = map[OrderBy]string{
+	ByID:    `ORDER BY ` + sqlPinnedFirst + `q.id desc;`,
+	ByDate:  `ORDER BY ` + sqlPinnedFirst + `q.date desc, q.id desc;`,
+	ByScore: `ORDER BY ` + sqlPinnedFirst + `(upvotes - downvotes) desc, q.id desc;`,
+}
+
+// allQuery returns the query for every quote in the given order.
+func allQuery(filterLow bool, order OrderBy) (string, error) {
+	clause, ok := allOrders[order]
+	if !ok {
+		return "", fmt.Errorf("unknown order: %d", order)
+	}
+
+	if filterLow {
+		return sqlGetAllFiltered + clause, nil
+	}
+	return sqlGetAll + clause, nil
+}
+
+// GetAll quotes, pinned quotes and then the newest id first. It's the same
+// as GetAllOrdered with ByID.
+func (q *QuoteDB) GetAll(filterLow bool) ([]Quote, error) {
+	return q.GetAllOrdered(filterLow, ByID)
+}
+
+// GetAllOrdered returns every quote in the given order.
+func (q *QuoteDB) GetAllOrdered(filterLow bool, order OrderBy) ([]Quote, error) {
+	query, err := allQuery(filterLow, order)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.queryQuotes(query)
+}
+
+// GetPage returns a page of the quotes in the given order along with how
+// many quotes there are on all pages. Pages are numbered from 1 and a page
+// past the last one is empty.
+func (q *QuoteDB) GetPage(page, perPage int, filterLow bool, order OrderBy) (quotes []Quote, total int, err error) {
+	if page < 1 || perPage < 1 {
+		return nil, 0, fmt.Errorf("invalid page %d of %d quotes", page, perPage)
+	}
+
+	query, err := allQuery(filterLow, order)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	countQuery := sqlCountAll
+	if filterLow {
+		countQuery = sqlCountAllFiltered
+	}
+	if err = q.db.QueryRow(q.withThreshold(countQuery)).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count quotes: %w", dbError(err))
+	}
+
+	query = strings.TrimSuffix(query, ";") + ` LIMIT ? OFFSET ?;`
+	quotes, err = q.queryQuotes(query, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return quotes, total, nil
+}
+
+// GetAllIn returns the quotes of a single collection, pinned quotes and then
+// the newest id first. It's the same as GetAllInOrdered with ByID.
+//
+// Collections let one database hold the quotes of separate communities, but
+// they aren't separate namespaces. Only the methods that take a collection
+// and the /c/{name}/ page keep them apart, every other method, page and api
+// endpoint sees the quotes of all collections.
+func (q *QuoteDB) GetAllIn(collection string, filterLow bool) ([]Quote, error) {
+	return q.GetAllInOrdered(collection, filterLow, ByID)
+}
+
+// GetAllInOrdered returns the quotes of a single collection in the given
+// order, see GetAllIn.
+func (q *QuoteDB) GetAllInOrdered(collection string, filterLow bool, order OrderBy) ([]Quote, error) {
+	clause, ok := allOrders[order]
+	if !ok {
+		return nil, fmt.Errorf("unknown order: %d", order)
+	}
+
+	if filterLow {
+		return q.queryQuotes(sqlGetAllInFiltered+clause, collection)
+	}
+	return q.queryQuotes(sqlGetAllIn+clause, collection)
+}
+
+// GetAllMinVotes returns the quotes with at least minTotal upvotes plus
+// downvotes, newest id first. It's for showing established quotes, unlike
+// filterLow it doesn't care whether the votes are for or against.
+func (q *QuoteDB) GetAllMinVotes(minTotal int, filterLow bool) ([]Quote, error) {
+	if filterLow {
+		return q.queryQuotes(sqlGetMinVotesFiltered, minTotal)
+	}
+	return q.queryQuotes(sqlGetMinVotes, minTotal)
+}
+
+// RecentQuotes returns up to n of the newest quotes, ordered by date desc.
+// Quotes below the visibility threshold are excluded. An n of 0 or less
+// returns no quotes.
+func (q *QuoteDB) RecentQuotes(n int) ([]Quote, error) {
+	if n <= 0 {
+		return make([]Quote, 0), nil
+	}
+
+	return q.queryQuotes(sqlGetRecent, n)
+}
+
+// GetSince returns the quotes added after t, oldest first, for catching up
+// on quotes since a user last looked. Quotes below the visibility threshold
+// are excluded.
+func (q *QuoteDB) GetSince(t time.Time) ([]Quote, error) {
+	return q.queryQuotes(sqlGetSince, t.Unix())
+}
+
+// GetBefore returns up to limit quotes with an id less than id, newest id
+// first. It's for paging through the quotes, the id of the last quote
+// returned is where the next page starts. Unlike an offset this is stable
+// when quotes are added while paging. An id of 0 or less starts at the
+// newest quote, a limit of 0 or less returns no quotes.
+func (q *QuoteDB) GetBefore(id, limit int, filterLow bool) ([]Quote, error) {
+	if limit <= 0 {
+		return make([]Quote, 0), nil
+	}
+	if id <= 0 {
+		id = math.MaxInt
 	}
 
-	quote.Date = time.Unix(date, 0).UTC()
+	query := sqlGetBefore
+	if filterLow {
+		query = sqlGetBeforeFiltered
+	}
 
-	return quote, nil
+	return q.queryQuotes(query, id, limit)
 }
 
-// DelQuote deletes a quote by id.
-func (q *QuoteDB) DelQuote(id int) (bool, error) {
-	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
-	if err != nil {
-		return false, err
+// GetByDateRange returns the quotes added in [start, end) ordered by date
+// desc. Dates are stored with second precision.
+func (q *QuoteDB) GetByDateRange(start, end time.Time, filterLow bool) ([]Quote, error) {
+	query := sqlGetByDateRange
+	if filterLow {
+		query = sqlGetByDateRangeFiltered
 	}
 
-	var res sql.Result
-	deleted := int64(0)
-	runTx := func() error {
-		if _, err = tx.Exec(sqlDelVotes, id); err != nil {
-			return fmt.Errorf("failed deleting quote votes: %w", err)
-		}
+	return q.queryQuotes(query, start.Unix(), end.Unix())
+}
 
-		if res, err = tx.Exec(sqlDel, id); err != nil {
-			return fmt.Errorf("failed deleting quote: %w", err)
-		}
+// Trending returns up to limit quotes that received votes within the window,
+// ordered by the net score of only those recent votes. A limit of 0 or less
+// returns no quotes.
+func (q *QuoteDB) Trending(window time.Duration, limit int) ([]Quote, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("trending window must be positive: %v", window)
+	}
+	if limit <= 0 {
+		return make([]Quote, 0), nil
+	}
 
-		if deleted, err = res.RowsAffected(); err != nil {
-			return fmt.Errorf("failed getting rows affected: %w", err)
-		}
+	return q.queryQuotes(sqlGetTrending, time.Now().Add(-window).Unix(), limit)
+}
 
-		return nil
+// TopQuotes returns the n highest scoring quotes, an n of 0 or less returns
+// no quotes.
+func (q *QuoteDB) TopQuotes(n int) ([]Quote, error) {
+	if n <= 0 {
+		return make([]Quote, 0), nil
 	}
 
-	err = runTx()
-	if err != nil {
-		if rerr := tx.Rollback(); err != nil {
-			return false, fmt.Errorf("failed to rollback due to error (%v): %w", rerr, err)
-		}
-		return false, fmt.Errorf("failed to delquote: %w", err)
-	}
+	return q.queryQuotes(sqlGetTop, n)
+}
 
-	if err := tx.Commit(); err != nil {
-		return false, fmt.Errorf("failed to commit delquote: %w", err)
+// BottomQuotes returns the n lowest scoring quotes, including those that are
+// normally hidden by the visibility threshold. An n of 0 or less returns no
+// quotes.
+func (q *QuoteDB) BottomQuotes(n int) ([]Quote, error) {
+	if n <= 0 {
+		return make([]Quote, 0), nil
 	}
 
-	if deleted != 1 {
-		return false, nil
+	return q.queryQuotes(sqlGetBottom, n)
+}
+
+// GetByAuthor returns the quotes whose author is exactly author, or
+// NormalizeAuthor(author) when author normalization is enabled and
+// TrimAuthor(author) when author trimming is.
+func (q *QuoteDB) GetByAuthor(author string, filterLow bool) ([]Quote, error) {
+	query := sqlGetByAuthor
+	if filterLow {
+		query = sqlGetByAuthorFiltered
 	}
 
-	q.Lock()
-	q.nQuotes--
-	q.Unlock()
-	return true, nil
+	return q.queryQuotes(query, q.storedAuthor(author))
 }
 
-// EditQuote edits a quote by id.
-func (q *QuoteDB) EditQuote(id int, quote string) (bool, error) {
-	var err error
-	var res sql.Result
-	var r int64
-	if res, err = q.db.Exec(sqlEdit, quote, id); err != nil {
-		return false, err
+// ForEachQuote calls fn with every quote in the same order as GetAll without
+// holding them all in memory. Iteration stops at the first error returned
+// by fn, which is then returned as is.
+func (q *QuoteDB) ForEachQuote(filterLow bool, fn func(Quote) error) error {
+	query, err := allQuery(filterLow, ByID)
+	if err != nil {
+		return err
 	}
-	if r, err = res.RowsAffected(); err != nil {
-		return false, err
+
+	return q.eachQuote(fn, query)
+}
+
+// queryQuotes runs a query that selects sqlQuoteColumns and collects the
+// rows into quotes.
+func (q *QuoteDB) queryQuotes(query string, args ...interface{}) ([]Quote, error) {
+	quotes := make([]Quote, 0)
+	err := q.eachQuote(func(quote Quote) error {
+		quotes = append(quotes, quote)
+		return nil
+	}, query, args...)
+	if err != nil {
+		return nil, err
 	}
-	return r == 1, nil
+
+	return quotes, nil
 }
 
-// GetAll quotes
-func (q *QuoteDB) GetAll(filterLow bool) ([]Quote, error) {
-	var err error
+// withThreshold puts the QuoteDB's visibility threshold into query in place
+// of sqlThreshold.
+func (q *QuoteDB) withThreshold(query string) string {
+	return strings.ReplaceAll(query, sqlThreshold, strconv.Itoa(q.threshold))
+}
 
-	query := sqlGetAll
-	if filterLow {
-		query = sqlGetAllFiltered
-	}
-	rows, err := q.db.Query(query)
+// eachQuote runs a query that selects sqlQuoteColumns and calls fn for each
+// row, the rows are always closed before it returns.
+func (q *QuoteDB) eachQuote(fn func(Quote) error, query string, args ...interface{}) error {
+	rows, err := q.db.Query(q.withThreshold(query), args...)
 	if err != nil {
-		return nil, err
+		return dbError(err)
 	}
 
-	quotes := make([]Quote, 0)
-	quote := Quote{}
 	for rows.Next() {
-		var date int64
-		if err = rows.Scan(&quote.ID, &date, &quote.Author, &quote.Quote, &quote.Upvotes, &quote.Downvotes); err != nil {
+		quote, err := scanQuote(rows)
+		if err != nil {
 			if cerr := rows.Close(); cerr != nil {
-				return nil, fmt.Errorf("failed to scan quotes (%w) but also close quotes: %v", err, cerr)
+				return fmt.Errorf("failed to scan quotes (%w) but also close quotes: %v", err, cerr)
 			}
-			return nil, fmt.Errorf("failed to scan quotes: %w", err)
+			return fmt.Errorf("failed to scan quotes: %w", err)
 		}
 
-		quote.Date = time.Unix(date, 0).UTC()
-
-		quotes = append(quotes, quote)
+		if err = fn(quote); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return fmt.Errorf("failed to close quotes (%v) after: %w", cerr, err)
+			}
+			return err
+		}
 	}
 
 	if err = rows.Close(); err != nil {
-		return nil, fmt.Errorf("error closing rows in getall: %w", err)
+		return fmt.Errorf("error closing quote rows: %w", dbError(err))
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error reading all rows: %w", err)
+		return fmt.Errorf("error reading all rows: %w", dbError(err))
 	}
 
-	return quotes, nil
+	return nil
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanQuote scans a row made up of sqlQuoteColumns.
+func scanQuote(row rowScanner) (quote Quote, err error) {
+	var date int64
+	err = row.Scan(
+		&quote.ID,
+		&date,
+		&quote.Author,
+		&quote.Quote,
+		&quote.Source,
+		&quote.Collection,
+		&quote.Submitter,
+		&quote.Views,
+		&quote.Upvotes,
+		&quote.Downvotes,
+		&quote.Locked,
+		&quote.Pinned)
+	if err != nil {
+		return quote, dbError(err)
+	}
+
+	quote.Date = time.Unix(date, 0).UTC()
+
+	return quote, nil
+}
+
+// voteWeightOf returns how much a vote from voter counts for, it's 1 unless
+// WithVoteWeight was used and is never less than 1.
+func (q *QuoteDB) voteWeightOf(voter string) int {
+	if q.voteWeight == nil {
+		return 1
+	}
+	if w := q.voteWeight(voter); w > 1 {
+		return w
+	}
+	return 1
 }
 
 // Upvote returns true iff the upvote was applied, if it was not applied
-// it's because the user already has a vote for that quote
+// it's because the user already has a vote for that quote. It returns
+// ErrQuoteNotFound if there is no such quote.
 func (q *QuoteDB) Upvote(id int, voter string) (bool, error) {
+	if !q.voteLimiter.allow(voter) {
+		return false, ErrRateLimited
+	}
+
 	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
 	if err != nil {
-		return false, err
+		return false, dbError(err)
 	}
 
 	alreadyVoted := false
+	before := 0
 	runTx := func() error {
 		// If we have a +1 already, return false, nil
 		// If we have a -1, delete it, and add the +1
@@ -360,16 +1645,20 @@ func (q *QuoteDB) Upvote(id int, voter string) (bool, error) {
 		var quoteExists int
 		err = tx.QueryRow(sqlHasQuote, id).Scan(&quoteExists)
 		if err != nil {
-			return err
+			return dbError(err)
 		}
 
 		if quoteExists == 0 {
-			return errors.New("Not a valid id")
+			return ErrQuoteNotFound
 		}
 
 		var vote int
-		err = tx.QueryRow(sqlHasVote, id, voter).Scan(&vote)
+		err = txQueryRow(tx, q.stmts.hasVote, sqlHasVote, id, voter).Scan(&vote)
 		if err != nil && err != sql.ErrNoRows {
+			return dbError(err)
+		}
+
+		if before, err = q.scoreBefore(tx, id); err != nil {
 			return err
 		}
 
@@ -380,42 +1669,58 @@ func (q *QuoteDB) Upvote(id int, voter string) (bool, error) {
 			return nil
 		case vote < 0:
 			// Delete old downvote
-			if _, err = tx.Exec(sqlUnvote, id, voter); err != nil {
+			if err = deleteVote(tx, id, voter); err != nil {
 				return fmt.Errorf("failed to delete old downvote: %w", err)
 			}
 		}
 
-		if _, err = tx.Exec(sqlUpvote, id, voter, time.Now().Unix()); err != nil {
+		var inserted bool
+		inserted, err = q.insertVote(tx, id, voter, q.voteWeightOf(voter))
+		if err != nil {
 			return fmt.Errorf("failed to execute upvote: %w", err)
 		}
+		alreadyVoted = !inserted
 
 		return nil
 	}
 
 	err = runTx()
 	if err != nil {
-		if rerr := tx.Rollback(); err != nil {
-			return false, fmt.Errorf("failed to rollback due to error (%v): %w", rerr, err)
+		if rerr := tx.Rollback(); rerr != nil {
+			return false, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
 		}
 		return false, fmt.Errorf("failed to upvote: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return false, fmt.Errorf("failed to commit upvote: %w", err)
+		return false, fmt.Errorf("failed to commit upvote: %w", dbError(err))
+	}
+
+	if !alreadyVoted {
+		q.Lock()
+		q.nVoted++
+		q.Unlock()
+		q.emitVote(id, voter, Up, before)
 	}
 
 	return !alreadyVoted, nil
 }
 
 // Downvote returns true iff the upvote was applied, if it was not applied
-// it's because the user already has a vote for that quote
+// it's because the user already has a vote for that quote. It returns
+// ErrQuoteNotFound if there is no such quote.
 func (q *QuoteDB) Downvote(id int, voter string) (bool, error) {
+	if !q.voteLimiter.allow(voter) {
+		return false, ErrRateLimited
+	}
+
 	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
 	if err != nil {
-		return false, err
+		return false, dbError(err)
 	}
 
 	alreadyVoted := false
+	before := 0
 	runTx := func() error {
 		// If we have a -1 already, return false, nil
 		// If we have a +1, delete it, and add the -1
@@ -423,16 +1728,20 @@ func (q *QuoteDB) Downvote(id int, voter string) (bool, error) {
 		var quoteExists int
 		err = tx.QueryRow(sqlHasQuote, id).Scan(&quoteExists)
 		if err != nil {
-			return err
+			return dbError(err)
 		}
 
 		if quoteExists == 0 {
-			return errors.New("Not a valid id")
+			return ErrQuoteNotFound
 		}
 
 		var vote int
-		err = tx.QueryRow(sqlHasVote, id, voter).Scan(&vote)
+		err = txQueryRow(tx, q.stmts.hasVote, sqlHasVote, id, voter).Scan(&vote)
 		if err != nil && err != sql.ErrNoRows {
+			return dbError(err)
+		}
+
+		if before, err = q.scoreBefore(tx, id); err != nil {
 			return err
 		}
 
@@ -443,39 +1752,53 @@ func (q *QuoteDB) Downvote(id int, voter string) (bool, error) {
 			return nil
 		case vote > 0:
 			// Delete old upvote
-			if _, err = tx.Exec(sqlUnvote, id, voter); err != nil {
+			if err = deleteVote(tx, id, voter); err != nil {
 				return fmt.Errorf("failed to delete old upvote: %w", err)
 			}
 		}
 
-		if _, err = tx.Exec(sqlDownvote, id, voter, time.Now().Unix()); err != nil {
+		var inserted bool
+		inserted, err = q.insertVote(tx, id, voter, -q.voteWeightOf(voter))
+		if err != nil {
 			return fmt.Errorf("failed to exec downvote: %w", err)
 		}
+		alreadyVoted = !inserted
 
 		return nil
 	}
 
 	err = runTx()
 	if err != nil {
-		if rerr := tx.Rollback(); err != nil {
-			return false, fmt.Errorf("failed to rollback due to error (%v): %w", rerr, err)
+		if rerr := tx.Rollback(); rerr != nil {
+			return false, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
 		}
 		return false, fmt.Errorf("failed to downvote: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return false, fmt.Errorf("failed to commit downvote: %w", err)
+		return false, fmt.Errorf("failed to commit downvote: %w", dbError(err))
+	}
+
+	if !alreadyVoted {
+		q.Lock()
+		q.nVoted++
+		q.Unlock()
+		q.emitVote(id, voter, Down, before)
 	}
 
 	return !alreadyVoted, nil
 }
 
 // Unvote returns true iff there was a vote that was removed, otherwise it
-// return false.
+// return false. It returns ErrQuoteNotFound if there is no such quote.
 func (q *QuoteDB) Unvote(id int, voter string) (bool, error) {
+	if !q.voteLimiter.allow(voter) {
+		return false, ErrRateLimited
+	}
+
 	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
 	if err != nil {
-		return false, err
+		return false, dbError(err)
 	}
 
 	actuallyDeleted := false
@@ -483,22 +1806,22 @@ func (q *QuoteDB) Unvote(id int, voter string) (bool, error) {
 		var quoteExists int
 		err = tx.QueryRow(sqlHasQuote, id).Scan(&quoteExists)
 		if err != nil {
-			return err
+			return dbError(err)
 		}
 
 		if quoteExists == 0 {
-			return errors.New("Not a valid id")
+			return ErrQuoteNotFound
 		}
 
 		var throwaway int
-		err = tx.QueryRow(sqlHasVote, id, voter).Scan(&throwaway)
+		err = txQueryRow(tx, q.stmts.hasVote, sqlHasVote, id, voter).Scan(&throwaway)
 		if err == sql.ErrNoRows {
 			return nil
 		} else if err != nil {
-			return err
+			return dbError(err)
 		}
 
-		if _, err = tx.Exec(sqlUnvote, id, voter); err != nil {
+		if err = deleteVote(tx, id, voter); err != nil {
 			return err
 		}
 
@@ -508,27 +1831,321 @@ func (q *QuoteDB) Unvote(id int, voter string) (bool, error) {
 
 	err = runTx()
 	if err != nil {
-		if rerr := tx.Rollback(); err != nil {
-			return false, fmt.Errorf("failed to rollback due to error (%v): %w", rerr, err)
+		if rerr := tx.Rollback(); rerr != nil {
+			return false, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
 		}
 		return false, fmt.Errorf("failed to delete vote: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return false, fmt.Errorf("failed to commit delete vote: %w", err)
+		return false, fmt.Errorf("failed to commit delete vote: %w", dbError(err))
 	}
 
 	return actuallyDeleted, nil
 }
 
+// SetVote sets the voter's vote on a quote to direction, None removes the
+// vote. It returns true iff the voter's vote was changed and ErrQuoteNotFound
+// if there is no such quote.
+func (q *QuoteDB) SetVote(id int, voter string, direction Direction) (bool, error) {
+	if !direction.valid() {
+		return false, fmt.Errorf("invalid vote direction: %d", direction)
+	}
+
+	if !q.voteLimiter.allow(voter) {
+		return false, ErrRateLimited
+	}
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return false, dbError(err)
+	}
+
+	changed := false
+	before := 0
+	runTx := func() error {
+		var quoteExists int
+		err = tx.QueryRow(sqlHasQuote, id).Scan(&quoteExists)
+		if err != nil {
+			return dbError(err)
+		}
+
+		if quoteExists == 0 {
+			return ErrQuoteNotFound
+		}
+
+		var vote Direction
+		err = txQueryRow(tx, q.stmts.hasVote, sqlHasVote, id, voter).Scan(&vote)
+		if err != nil && err != sql.ErrNoRows {
+			return dbError(err)
+		}
+
+		if before, err = q.scoreBefore(tx, id); err != nil {
+			return err
+		}
+
+		if vote == direction {
+			return nil
+		}
+
+		if vote != 0 {
+			if err = deleteVote(tx, id, voter); err != nil {
+				return fmt.Errorf("failed to delete old vote: %w", err)
+			}
+		}
+
+		changed = true
+		if direction == None {
+			return nil
+		}
+
+		var inserted bool
+		inserted, err = q.insertVote(tx, id, voter, int(direction)*q.voteWeightOf(voter))
+		if err != nil {
+			return fmt.Errorf("failed to execute vote: %w", err)
+		}
+		changed = inserted
+		return nil
+	}
+
+	err = runTx()
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return false, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return false, fmt.Errorf("failed to set vote: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit set vote: %w", dbError(err))
+	}
+
+	if changed && direction != None {
+		q.Lock()
+		q.nVoted++
+		q.Unlock()
+		q.emitVote(id, voter, direction, before)
+	}
+
+	return changed, nil
+}
+
+// insertVote records a vote with the given signed weight, inserted is false
+// if the voter already had a vote on the quote. That only happens when
+// another transaction voted after the caller checked, which can't be told
+// apart from having voted already.
+func (q *QuoteDB) insertVote(tx *sql.Tx, id int, voter string, weight int) (inserted bool, err error) {
+	res, err := txExec(tx, q.stmts.vote, sqlVote, id, voter, weight, time.Now().Unix())
+	if err != nil {
+		return false, dbError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError(err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	if err = changeScore(tx, id, weight, 1); err != nil {
+		return false, err
+	}
+	if q.autoLock > 0 {
+		if _, err = tx.Exec(sqlAutoLock, id, q.autoLock); err != nil {
+			return false, fmt.Errorf("failed to lock quote: %w", dbError(err))
+		}
+	}
+	return true, nil
+}
+
+// deleteVote removes the voter's vote on a quote and takes it off the
+// quote's score.
+func deleteVote(tx *sql.Tx, id int, voter string) error {
+	var vote int
+	if err := tx.QueryRow(sqlGetVoteWeight, id, voter).Scan(&vote); err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return dbError(err)
+	}
+
+	if _, err := tx.Exec(sqlUnvote, id, voter); err != nil {
+		return dbError(err)
+	}
+
+	return changeScore(tx, id, vote, -1)
+}
+
+// changeScore adds a vote to the upvotes or downvotes stored on a quote, or
+// takes it away when n is -1.
+func changeScore(tx *sql.Tx, id, vote, n int) error {
+	up, down := 0, 0
+	if vote > 0 {
+		up = vote * n
+	} else {
+		down = -vote * n
+	}
+
+	if _, err := tx.Exec(sqlChangeScore, up, down, id); err != nil {
+		return fmt.Errorf("failed to update score: %w", dbError(err))
+	}
+	return nil
+}
+
+// RecalculateScores recounts the upvotes and downvotes stored on every
+// quote from its votes. They're kept up to date by the vote methods, this is
+// for repairing them after the votes were changed some other way, like by
+// another tool.
+func (q *QuoteDB) RecalculateScores() error {
+	if _, err := q.db.Exec(sqlRecountScores); err != nil {
+		return fmt.Errorf("failed to recalculate scores: %w", dbError(err))
+	}
+
+	return nil
+}
+
 // Votes retrieves the vote counts for a quote
 func (q *QuoteDB) Votes(id int) (up, down int, err error) {
 	if err = q.db.QueryRow(sqlGetUpvotes, id).Scan(&up); err != nil {
-		return 0, 0, err
+		return 0, 0, dbError(err)
 	}
 	if err = q.db.QueryRow(sqlGetDownvotes, id).Scan(&down); err != nil {
-		return 0, 0, err
+		return 0, 0, dbError(err)
 	}
 
 	return up, down, nil
 }
+
+// GetVote returns the direction of the voter's vote on a quote, None if
+// they have not voted on it.
+func (q *QuoteDB) GetVote(id int, voter string) (Direction, error) {
+	var vote Direction
+	err := q.queryRow(q.stmts.hasVote, sqlHasVote, id, voter).Scan(&vote)
+	if err == sql.ErrNoRows {
+		return None, nil
+	} else if err != nil {
+		return None, dbError(err)
+	}
+
+	return vote, nil
+}
+
+// GetVotedBy returns the quotes the voter has voted on in the direction
+// given, or all of them for None, most recently voted on first.
+func (q *QuoteDB) GetVotedBy(voter string, direction Direction) ([]Quote, error) {
+	var filter string
+	switch direction {
+	case Up:
+		filter = `AND v.vote > 0 `
+	case Down:
+		filter = `AND v.vote < 0 `
+	case None:
+	default:
+		return nil, fmt.Errorf("invalid vote direction: %d", direction)
+	}
+
+	return q.queryQuotes(fmt.Sprintf(sqlGetVotedBy, filter), voter)
+}
+
+// voterVotes returns every vote the voter has made keyed by quote id.
+func (q *QuoteDB) voterVotes(voter string) (map[int]int, error) {
+	rows, err := q.db.Query(sqlGetVoterVotes, voter)
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	votes := make(map[int]int)
+	for rows.Next() {
+		var id, vote int
+		if err = rows.Scan(&id, &vote); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan votes (%w) but also close votes: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan votes: %w", dbError(err))
+		}
+
+		votes[id] = vote
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing vote rows: %w", dbError(err))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all vote rows: %w", dbError(err))
+	}
+
+	return votes, nil
+}
+
+// VotesBatch retrieves the vote counts for many quotes in a single query, or
+// one query per maxVariables ids. The map is keyed by quote id and holds the
+// upvotes and downvotes in that order, every requested id is present even if
+// it has no votes.
+func (q *QuoteDB) VotesBatch(ids []int) (map[int][2]int, error) {
+	counts := make(map[int][2]int, len(ids))
+	for _, id := range ids {
+		counts[id] = [2]int{}
+	}
+
+	for len(ids) != 0 {
+		batch := ids
+		if len(batch) > maxVariables {
+			batch = batch[:maxVariables]
+		}
+		ids = ids[len(batch):]
+
+		if err := q.votesBatch(batch, counts); err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+// votesBatch puts the vote counts of ids into counts with a single query.
+func (q *QuoteDB) votesBatch(ids []int, counts map[int][2]int) error {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(sqlGetVotesBatch, placeholders(len(ids)))
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return dbError(err)
+	}
+
+	for rows.Next() {
+		var id, up, down int
+		if err = rows.Scan(&id, &up, &down); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return fmt.Errorf("failed to scan votes (%w) but also close votes: %v", dbError(err), cerr)
+			}
+			return fmt.Errorf("failed to scan votes: %w", dbError(err))
+		}
+
+		counts[id] = [2]int{up, down}
+	}
+
+	if err = rows.Close(); err != nil {
+		return fmt.Errorf("error closing vote rows: %w", dbError(err))
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error reading all vote rows: %w", dbError(err))
+	}
+
+	return nil
+}
+
+// maxVariables is the most bind parameters a query may have, it's the
+// SQLITE_MAX_VARIABLE_NUMBER of sqlite versions before 3.32.0. Lists of ids
+// longer than that are queried in batches.
+const maxVariables = 999
+
+// placeholders returns n comma separated bind parameters for use in an IN
+// clause.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
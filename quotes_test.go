@@ -0,0 +1,373 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// newTestDB opens an empty in-memory QuoteDB that's closed when the test
+// ends.
+func newTestDB(t *testing.T, options ...Option) *QuoteDB {
+	t.Helper()
+
+	q, err := OpenMemoryDB("", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := q.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return q
+}
+
+func TestEditQuote(t *testing.T) {
+	t.Parallel()
+
+	q := newTestDB(t)
+	id64, err := q.AddQuote("bob", "original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int(id64)
+
+	t.Run("missing", func(t *testing.T) {
+		edited, err := q.EditQuote(id+1, "text", "editor")
+		if edited || !errors.Is(err, ErrQuoteNotFound) {
+			t.Errorf("got %t, %v want false, ErrQuoteNotFound", edited, err)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		edited, err := q.EditQuote(id, "original", "editor")
+		if !edited || err != nil {
+			t.Fatalf("got %t, %v want true, nil", edited, err)
+		}
+
+		edits, err := q.GetEditHistory(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(edits) != 0 {
+			t.Errorf("unchanged quote recorded edits: %v", edits)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		edited, err := q.EditQuote(id, "changed", "editor")
+		if !edited || err != nil {
+			t.Fatalf("got %t, %v want true, nil", edited, err)
+		}
+
+		quote, err := q.GetQuote(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quote.Quote != "changed" {
+			t.Errorf("quote is %q, want %q", quote.Quote, "changed")
+		}
+
+		edits, err := q.GetEditHistory(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(edits) != 1 || edits[0].Quote != "original" || edits[0].Editor != "editor" {
+			t.Errorf("edit history is %v, want the original quote by editor", edits)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var verr *ValidationError
+		edited, err := q.EditQuote(id, "  ", "editor")
+		if edited || !errors.As(err, &verr) {
+			t.Fatalf("got %t, %v want false, *ValidationError", edited, err)
+		}
+
+		quote, err := q.GetQuote(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quote.Quote != "changed" {
+			t.Errorf("quote is %q, want %q", quote.Quote, "changed")
+		}
+	})
+}
+
+// errTestRollback is returned by every rollback of the rollbackFail driver.
+var errTestRollback = errors.New("rollback failed")
+
+func init() {
+	sql.Register("sqlite3-rollback-fail", rollbackFailDriver{})
+}
+
+// rollbackFailDriver is the sqlite3 driver except that rolling back a
+// transaction returns errTestRollback once it's rolled back.
+type rollbackFailDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d rollbackFailDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return rollbackFailConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type rollbackFailConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c rollbackFailConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c rollbackFailConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return rollbackFailTx{tx}, nil
+}
+
+type rollbackFailTx struct {
+	driver.Tx
+}
+
+func (t rollbackFailTx) Rollback() error {
+	if err := t.Tx.Rollback(); err != nil {
+		return err
+	}
+	return errTestRollback
+}
+
+func TestRollbackError(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("sqlite3-rollback-fail", "file:quotes-rollback-test?mode=memory&cache=shared&_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	q, err := OpenDBWith(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := q.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// Votes on a quote that doesn't exist fail inside the transaction, which
+	// is then rolled back.
+	const missing = 1
+	tests := []struct {
+		Name string
+		Fn   func() (bool, error)
+	}{
+		{"upvote", func() (bool, error) { return q.Upvote(missing, "voter") }},
+		{"downvote", func() (bool, error) { return q.Downvote(missing, "voter") }},
+		{"unvote", func() (bool, error) { return q.Unvote(missing, "voter") }},
+	}
+
+	for _, test := range tests {
+		_, err := test.Fn()
+		if !errors.Is(err, errTestRollback) {
+			t.Errorf("%s: error %v does not wrap the rollback error", test.Name, err)
+		}
+		if !errors.Is(err, ErrDatabase) {
+			t.Errorf("%s: error %v does not wrap ErrDatabase", test.Name, err)
+		}
+	}
+}
+
+func TestQuoteLength(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		Quote  string
+		Length int
+		Words  int
+	}{
+		{Quote: "", Length: 0, Words: 0},
+		{Quote: "hello world", Length: 11, Words: 2},
+		{Quote: "héllo wörld", Length: 11, Words: 2},
+		{Quote: "日本語 です", Length: 6, Words: 2},
+		{Quote: "😀😀😀", Length: 3, Words: 1},
+		{Quote: "so 🔥 right now 😂", Length: 16, Words: 5},
+		{Quote: "  spaced\tout\n\nwords　here ", Length: 25, Words: 4},
+	}
+
+	for _, test := range tests {
+		quote := Quote{Quote: test.Quote}
+		if got := quote.Length(); got != test.Length {
+			t.Errorf("%q: length is %d, want %d", test.Quote, got, test.Length)
+		}
+		if got := quote.WordCount(); got != test.Words {
+			t.Errorf("%q: word count is %d, want %d", test.Quote, got, test.Words)
+		}
+	}
+}
+
+func TestConcurrentVotes(t *testing.T) {
+	t.Parallel()
+
+	// A file database so the votes really do run on separate connections.
+	q, err := OpenDB(filepath.Join(t.TempDir(), "quotes.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := q.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	id64, err := q.AddQuote("bob", "hammered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int(id64)
+
+	const voters, workers, rounds = 5, 4, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, voters*workers*rounds*3)
+	for v := 0; v < voters; v++ {
+		voter := fmt.Sprint("voter", v)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					if _, err := q.Upvote(id, voter); err != nil {
+						errs <- err
+					}
+					if _, err := q.Downvote(id, voter); err != nil {
+						errs <- err
+					}
+					if _, err := q.Upvote(id, voter); err != nil {
+						errs <- err
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Every voter's last call was an upvote.
+	up, down, err := q.Votes(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up != voters || down != 0 {
+		t.Errorf("votes are %d up %d down, want %d up 0 down", up, down, voters)
+	}
+
+	quote, err := q.GetQuote(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Upvotes != up || quote.Downvotes != down {
+		t.Errorf("stored score is %d up %d down, votes are %d up %d down",
+			quote.Upvotes, quote.Downvotes, up, down)
+	}
+}
+
+func TestSqliteDSN(t *testing.T) {
+	t.Parallel()
+
+	opts := url.Values{"_foreign_keys": {"1"}, "_busy_timeout": {"5000"}}
+	tests := []struct {
+		Name     string
+		Filename string
+		Want     string
+	}{
+		{
+			Name:     "plain",
+			Filename: "/var/lib/quotes.db",
+			Want:     "/var/lib/quotes.db?_busy_timeout=5000&_foreign_keys=1",
+		},
+		{
+			Name:     "spaces",
+			Filename: "/var/lib/my quotes.db",
+			Want:     "/var/lib/my quotes.db?_busy_timeout=5000&_foreign_keys=1",
+		},
+		{
+			Name:     "uri",
+			Filename: "file:/var/lib/quotes.db?mode=rwc&_busy_timeout=100",
+			Want:     "file:/var/lib/quotes.db?_busy_timeout=100&_foreign_keys=1&mode=rwc",
+		},
+		{
+			Name:     "caller wins",
+			Filename: "/var/lib/quotes.db?_foreign_keys=0",
+			Want:     "/var/lib/quotes.db?_busy_timeout=5000&_foreign_keys=0",
+		},
+		{
+			Name:     "memory",
+			Filename: ":memory:",
+			Want:     ":memory:?_busy_timeout=5000&_foreign_keys=1",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := sqliteDSN(test.Filename, opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.Name, err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("%s: got %q, want %q", test.Name, got, test.Want)
+		}
+	}
+
+	if _, err := sqliteDSN("?mode=memory", opts); err == nil {
+		t.Error("a dsn without a filename was accepted")
+	}
+}
+
+func TestOpenDBFilenames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filenames := []string{
+		filepath.Join(dir, "plain.db"),
+		filepath.Join(dir, "with spaces.db"),
+		"file:" + filepath.Join(dir, "uri.db") + "?mode=rwc",
+		":memory:",
+	}
+
+	for _, filename := range filenames {
+		q, err := OpenDB(filename, "")
+		if err != nil {
+			t.Errorf("%s: %v", filename, err)
+			continue
+		}
+
+		if _, err = q.AddQuote("bob", "hello"); err != nil {
+			t.Errorf("%s: %v", filename, err)
+		} else if quotes, err := q.GetAll(false); err != nil || len(quotes) != 1 {
+			t.Errorf("%s: got %d quotes (%v), want 1", filename, len(quotes), err)
+		}
+
+		if err = q.Close(); err != nil {
+			t.Errorf("%s: %v", filename, err)
+		}
+	}
+}
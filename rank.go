@@ -0,0 +1,195 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// rankCandidates caps how many quotes are scored in Go by the ranking
+// methods that can't be done in sql.
+const rankCandidates = 1000
+
+// wilsonZ is the z-score for a 95% confidence interval.
+const wilsonZ = 1.96
+
+const (
+	// hotHalfLives bounds HotRank to votes from this many half lives ago,
+	// older votes count for less than 0.1% of a new one.
+	hotHalfLives = 10
+	// hotMaxVotes caps how many of the newest votes HotRank reads.
+	hotMaxVotes = 100000
+)
+
+const (
+	sqlGetRankCandidates = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes + downvotes) > 0 AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY (upvotes + downvotes) desc, q.id desc LIMIT ?;`
+	sqlGetHotVotes = `SELECT v.quote_id, v.vote, v.date FROM votes AS v ` +
+		`INNER JOIN quotes AS q ON q.id = v.quote_id ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND v.date >= ? ` +
+		`AND ` + sqlNetScore + ` > ` + sqlThreshold + ` ` +
+		`ORDER BY v.date desc LIMIT ?;`
+
+	// sqlRandomWeights gives every eligible quote a weight of its net score
+	// offset so the lowest score that's still above the threshold weighs 1.
+	sqlRandomWeights = `SELECT q.id, ` + sqlNetScore + ` - (` + sqlThreshold + `) AS weight FROM quotes as q ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved' AND ` + sqlNetScore + ` > ` + sqlThreshold
+	sqlGetWeightTotal = `SELECT COALESCE(SUM(weight), 0) FROM (` + sqlRandomWeights + `);`
+	sqlGetByCumWeight = `SELECT id FROM (SELECT id, SUM(weight) OVER (ORDER BY id) AS cum FROM (` + sqlRandomWeights + `)) ` +
+		`WHERE cum > ? ORDER BY cum LIMIT 1;`
+)
+
+// RankByConfidence returns up to limit quotes ordered by the lower bound of
+// the Wilson score interval of their votes, which favors quotes that are
+// reliably liked over quotes that merely have a lot of votes. Each quote's
+// Confidence is set to its score. Only the most voted quotes are considered.
+func (q *QuoteDB) RankByConfidence(limit int) ([]Quote, error) {
+	if limit <= 0 {
+		return make([]Quote, 0), nil
+	}
+
+	quotes, err := q.queryQuotes(sqlGetRankCandidates, rankCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range quotes {
+		quotes[i].Confidence = wilson(quotes[i].Upvotes, quotes[i].Downvotes)
+	}
+
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Confidence > quotes[j].Confidence
+	})
+
+	if limit < len(quotes) {
+		quotes = quotes[:limit]
+	}
+	return quotes, nil
+}
+
+// HotRank returns up to limit quotes ordered by a score where each vote
+// counts for less the older it is, halving every halfLife, so quotes that
+// are being voted on now rise to the top. Each quote's Hotness is set to
+// its score. Quotes without recent votes and those below the visibility
+// threshold are left out.
+//
+// sqlite has no exp so the scores are calculated from the votes in Go, only
+// the newest votes cast within 10 half lives are considered.
+func (q *QuoteDB) HotRank(halfLife time.Duration, limit int) ([]Quote, error) {
+	if halfLife <= 0 {
+		return nil, fmt.Errorf("half life must be positive: %v", halfLife)
+	}
+	if limit <= 0 {
+		return make([]Quote, 0), nil
+	}
+
+	now := time.Now()
+	since := now.Add(-hotHalfLives * halfLife).Unix()
+	rows, err := q.db.Query(q.withThreshold(sqlGetHotVotes), since, hotMaxVotes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get votes: %w", dbError(err))
+	}
+
+	scores := make(map[int]float64)
+	for rows.Next() {
+		var id, vote int
+		var date int64
+		if err = rows.Scan(&id, &vote, &date); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan votes (%w) but also close votes: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan votes: %w", dbError(err))
+		}
+
+		age := now.Sub(time.Unix(date, 0))
+		scores[id] += float64(vote) * math.Exp2(-float64(age)/float64(halfLife))
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing rows in hot rank: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all vote rows: %w", dbError(err))
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+	if limit < len(ids) {
+		ids = ids[:limit]
+	}
+
+	quotes, err := q.GetQuotes(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range quotes {
+		quotes[i].Hotness = scores[quotes[i].ID]
+	}
+	return quotes, nil
+}
+
+// RandomWeighted picks a random quote like RandomQuote, but the higher a
+// quote's score the more likely it is to be picked. A quote's chance is
+// proportional to its score offset so the lowest score above the visibility
+// threshold counts as 1, so every eligible quote can still come up. It
+// returns ErrNoQuotes if there are no eligible quotes.
+func (q *QuoteDB) RandomWeighted() (Quote, error) {
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Quote{}, dbError(err)
+	}
+
+	var id int
+	runTx := func() error {
+		var total int64
+		if err = tx.QueryRow(q.withThreshold(sqlGetWeightTotal)).Scan(&total); err != nil {
+			return fmt.Errorf("failed to sum weights: %w", dbError(err))
+		}
+		if total == 0 {
+			return ErrNoQuotes
+		}
+
+		if err = tx.QueryRow(q.withThreshold(sqlGetByCumWeight), rand.Int63n(total)).Scan(&id); err != nil {
+			return fmt.Errorf("failed to pick quote: %w", dbError(err))
+		}
+		return nil
+	}
+
+	err = runTx()
+	if rerr := tx.Rollback(); rerr != nil {
+		if err != nil {
+			return Quote{}, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return Quote{}, dbError(rerr)
+	}
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return q.GetQuote(id)
+}
+
+// wilson calculates the lower bound of the Wilson score interval.
+func wilson(up, down int) float64 {
+	n := float64(up + down)
+	if n == 0 {
+		return 0
+	}
+
+	z2 := wilsonZ * wilsonZ
+	phat := float64(up) / n
+	return (phat + z2/(2*n) - wilsonZ*math.Sqrt((phat*(1-phat)+z2/(4*n))/n)) / (1 + z2/n)
+}
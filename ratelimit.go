@@ -0,0 +1,102 @@
+package quotes
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiterPruneSize is how many keys a rateLimiter tracks before it starts
+// forgetting keys whose buckets have refilled.
+const rateLimiterPruneSize = 1024
+
+// rateLimiter is an in-memory token bucket per key. Each bucket holds up to
+// n tokens and refills at n tokens per window. A nil rateLimiter allows
+// everything.
+type rateLimiter struct {
+	mut     sync.Mutex
+	n       float64
+	window  time.Duration
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(n int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		n:       float64(n),
+		window:  window,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// validate returns an error if the window isn't positive, the buckets would
+// never refill.
+func (r *rateLimiter) validate() error {
+	if r != nil && r.window <= 0 {
+		return fmt.Errorf("rate limit window must be positive: %v", r.window)
+	}
+	return nil
+}
+
+// allow takes a token from key's bucket and returns false if there was none.
+func (r *rateLimiter) allow(key string) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	now := time.Now()
+	if len(r.buckets) >= rateLimiterPruneSize {
+		r.prune(now)
+	}
+
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: r.n, last: now}
+		r.buckets[key] = b
+	}
+
+	b.tokens += r.n * float64(now.Sub(b.last)) / float64(r.window)
+	if b.tokens > r.n {
+		b.tokens = r.n
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// refund gives back the token taken by allow when what it was taken for
+// didn't happen after all.
+func (r *rateLimiter) refund(key string) {
+	if r == nil {
+		return
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if b, ok := r.buckets[key]; ok && b.tokens+1 <= r.n {
+		b.tokens++
+	}
+}
+
+// prune forgets buckets that would be full by now, since a fresh bucket
+// behaves identically.
+func (r *rateLimiter) prune(now time.Time) {
+	for key, b := range r.buckets {
+		if b.tokens+r.n*float64(now.Sub(b.last))/float64(r.window) >= r.n {
+			delete(r.buckets, key)
+		}
+	}
+}
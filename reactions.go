@@ -0,0 +1,101 @@
+package quotes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	sqlCreateReactionsTable = `CREATE TABLE IF NOT EXISTS reactions (` +
+		`quote_id INTEGER NOT NULL,` +
+		`voter TEXT NOT NULL,` +
+		`reaction TEXT NOT NULL,` +
+		`date INTEGER NOT NULL,` +
+		`PRIMARY KEY (quote_id, voter, reaction),` +
+		`FOREIGN KEY (quote_id) REFERENCES quotes (id))`
+
+	sqlReact          = `INSERT OR IGNORE INTO reactions (quote_id, voter, reaction, date) VALUES (?, ?, ?, ?);`
+	sqlUnreact        = `DELETE FROM reactions WHERE quote_id = ? AND voter = ? AND reaction = ?;`
+	sqlReactionCounts = `SELECT reaction, COUNT(*) FROM reactions WHERE quote_id = ? GROUP BY reaction;`
+	sqlDelReactions   = `DELETE FROM reactions WHERE quote_id = ?;`
+	sqlPurgeReactions = `DELETE FROM reactions WHERE quote_id IN (SELECT id FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?);`
+)
+
+// maxReactionLen bounds the length of a reaction, they're meant to be a
+// short name or an emoji.
+const maxReactionLen = 32
+
+// React adds a reaction (like "laugh" or an emoji) from voter to a quote, a
+// voter may have several different reactions on the same quote. Reacting the
+// same way twice is not an error. Reactions are separate from votes and
+// don't affect a quote's score.
+func (q *QuoteDB) React(id int, voter, reaction string) error {
+	reaction = strings.TrimSpace(reaction)
+	if len(reaction) == 0 || len(reaction) > maxReactionLen {
+		return errors.New("reaction must be between 1 and 32 bytes")
+	}
+
+	var quoteExists int
+	if err := q.db.QueryRow(sqlHasQuote, id).Scan(&quoteExists); err != nil {
+		return dbError(err)
+	}
+	if quoteExists == 0 {
+		return ErrQuoteNotFound
+	}
+
+	if _, err := q.db.Exec(sqlReact, id, voter, reaction, time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to react: %w", dbError(err))
+	}
+
+	return nil
+}
+
+// Unreact removes a reaction from voter, it returns true iff the reaction
+// existed.
+func (q *QuoteDB) Unreact(id int, voter, reaction string) (bool, error) {
+	res, err := q.db.Exec(sqlUnreact, id, voter, strings.TrimSpace(reaction))
+	if err != nil {
+		return false, fmt.Errorf("failed to unreact: %w", dbError(err))
+	}
+
+	r, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError(err)
+	}
+	return r == 1, nil
+}
+
+// ReactionCounts returns how many voters reacted to a quote with each
+// reaction.
+func (q *QuoteDB) ReactionCounts(id int) (map[string]int, error) {
+	rows, err := q.db.Query(sqlReactionCounts, id)
+	if err != nil {
+		return nil, dbError(err)
+	}
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var reaction string
+		var count int
+		if err = rows.Scan(&reaction, &count); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan reactions (%w) but also close reactions: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan reactions: %w", dbError(err))
+		}
+
+		counts[reaction] = count
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing reaction rows: %w", dbError(err))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all reaction rows: %w", dbError(err))
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,132 @@
+package quotes
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	sqlCreateReportsTable = `CREATE TABLE IF NOT EXISTS reports (` +
+		`quote_id INTEGER NOT NULL,` +
+		`reporter TEXT NOT NULL,` +
+		`reason TEXT NOT NULL,` +
+		`date INTEGER NOT NULL,` +
+		`PRIMARY KEY (quote_id, reporter),` +
+		`FOREIGN KEY (quote_id) REFERENCES quotes (id))`
+
+	sqlAddReport    = `INSERT INTO reports (quote_id, reporter, reason, date) VALUES (?, ?, ?, ?) ON CONFLICT (quote_id, reporter) DO NOTHING;`
+	sqlDelReports   = `DELETE FROM reports WHERE quote_id = ?;`
+	sqlPurgeReports = `DELETE FROM reports WHERE quote_id IN (SELECT id FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?);`
+	sqlMergeReports = `UPDATE OR IGNORE reports SET quote_id = ? WHERE quote_id = ?;`
+	sqlGetReports   = `SELECT quote_id, reason FROM reports ORDER BY date asc;`
+)
+
+// ReportedQuote is a quote that has been reported along with how many
+// reporters reported it and the reasons they gave, oldest first.
+type ReportedQuote struct {
+	Quote
+	Reports int      `json:"reports"`
+	Reasons []string `json:"reasons"`
+}
+
+// ReportQuote flags a quote for a moderator to look at, for example because
+// it's offensive. Each reporter can only report a quote once, reporting it
+// again returns ErrAlreadyReported. The reason may be empty.
+func (q *QuoteDB) ReportQuote(id int, reporter, reason string) error {
+	var quoteExists int
+	if err := q.db.QueryRow(sqlHasQuote, id).Scan(&quoteExists); err != nil {
+		return dbError(err)
+	}
+	if quoteExists == 0 {
+		return ErrQuoteNotFound
+	}
+
+	res, err := q.db.Exec(sqlAddReport, id, reporter, reason, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to report quote: %w", dbError(err))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed getting rows affected: %w", dbError(err))
+	}
+	if n == 0 {
+		return ErrAlreadyReported
+	}
+
+	return nil
+}
+
+// ClearReports removes every report of a quote, once a moderator has
+// decided to keep it.
+func (q *QuoteDB) ClearReports(id int) error {
+	if _, err := q.db.Exec(sqlDelReports, id); err != nil {
+		return fmt.Errorf("failed to clear reports: %w", dbError(err))
+	}
+
+	return nil
+}
+
+// GetReported returns the reported quotes for a moderation queue, the most
+// reported first. Empty reasons are left out of Reasons.
+func (q *QuoteDB) GetReported() ([]ReportedQuote, error) {
+	rows, err := q.db.Query(sqlGetReports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", dbError(err))
+	}
+
+	counts := make(map[int]int)
+	reasons := make(map[int][]string)
+	for rows.Next() {
+		var id int
+		var reason string
+		if err = rows.Scan(&id, &reason); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan reports (%w) but also close reports: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan reports: %w", dbError(err))
+		}
+
+		counts[id]++
+		if len(reason) != 0 {
+			reasons[id] = append(reasons[id], reason)
+		}
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing rows in get reported: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all report rows: %w", dbError(err))
+	}
+
+	ids := make([]int, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if counts[ids[i]] != counts[ids[j]] {
+			return counts[ids[i]] > counts[ids[j]]
+		}
+		return ids[i] > ids[j]
+	})
+
+	// Reports of deleted quotes stay until they're purged, GetQuotes leaves
+	// those out.
+	quotes, err := q.GetQuotes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	reported := make([]ReportedQuote, len(quotes))
+	for i, quote := range quotes {
+		reported[i] = ReportedQuote{
+			Quote:   quote,
+			Reports: counts[quote.ID],
+			Reasons: reasons[quote.ID],
+		}
+	}
+
+	return reported, nil
+}
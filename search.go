@@ -0,0 +1,122 @@
+package quotes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sorts understood by Search.
+const (
+	SortNew           = "new"
+	SortVotes         = "votes"
+	SortControversial = "controversial"
+)
+
+const (
+	searchDefaultPerPage = 20
+	searchMaxPerPage     = 100
+	// searchMaxPage keeps the offset of absurd pages from overflowing.
+	searchMaxPage = 100000
+)
+
+// SearchOptions narrows down the quotes returned by Search, empty fields
+// don't filter anything.
+type SearchOptions struct {
+	// Text must appear somewhere in the quote, case insensitive for ascii.
+	Text string
+	// Tag the quote must have.
+	Tag string
+	// Author of the quote, matched the same way as GetByAuthor.
+	Author string
+	// FilterLow hides quotes below the visibility threshold.
+	FilterLow bool
+
+	// Sort is one of SortNew (the default), SortVotes or SortControversial.
+	Sort string
+	// Page is 1-based and capped at 100000, PerPage defaults to 20 and is
+	// capped at 100.
+	Page    int
+	PerPage int
+}
+
+// searchOrders maps the sorts to their order by clauses, ties are always
+// broken by id desc.
+var searchOrders = map[string]string{
+	SortNew:           `q.date desc, q.id desc`,
+	SortVotes:         `(upvotes - downvotes) desc, q.id desc`,
+	SortControversial: `(CASE WHEN upvotes < downvotes THEN upvotes ELSE downvotes END) desc, (upvotes + downvotes) desc, q.id desc`,
+}
+
+// Search returns a page of the quotes matching opts along with the total
+// number of matching quotes across all pages.
+func (q *QuoteDB) Search(opts SearchOptions) ([]Quote, int, error) {
+	sort := opts.Sort
+	if len(sort) == 0 {
+		sort = SortNew
+	}
+	order, ok := searchOrders[sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort: %q", opts.Sort)
+	}
+
+	page, perPage := opts.Page, opts.PerPage
+	if page < 1 {
+		page = 1
+	}
+	if page > searchMaxPage {
+		page = searchMaxPage
+	}
+	if perPage < 1 {
+		perPage = searchDefaultPerPage
+	}
+	if perPage > searchMaxPerPage {
+		perPage = searchMaxPerPage
+	}
+
+	where := []string{`q.deleted_at IS NULL AND q.status = 'approved'`}
+	var args []interface{}
+	if len(opts.Text) != 0 {
+		where = append(where, `q.quote LIKE ? ESCAPE '`+likeEscape+`'`)
+		args = append(args, "%"+escapeLike(opts.Text)+"%")
+	}
+	if len(opts.Tag) != 0 {
+		where = append(where, `EXISTS(SELECT quote_id FROM tags WHERE quote_id = q.id AND tag = ?)`)
+		args = append(args, normalizeTag(opts.Tag))
+	}
+	if len(opts.Author) != 0 {
+		where = append(where, `q.author = ?`)
+		args = append(args, q.storedAuthor(opts.Author))
+	}
+	if opts.FilterLow {
+		where = append(where, `(upvotes - downvotes) > `+sqlThreshold)
+	}
+
+	query := `SELECT ` + sqlQuoteColumns + `FROM quotes as q WHERE ` + strings.Join(where, " AND ")
+
+	var total int
+	if err := q.db.QueryRow(q.withThreshold(`SELECT COUNT(*) FROM (`+query+`) AS matches;`), args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", dbError(err))
+	}
+
+	query += ` ORDER BY ` + order + ` LIMIT ? OFFSET ?;`
+	args = append(args, perPage, (page-1)*perPage)
+	quotes, err := q.queryQuotes(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search: %w", err)
+	}
+
+	return quotes, total, nil
+}
+
+// likeEscape is the ESCAPE character of every LIKE built with escapeLike.
+const likeEscape = `\`
+
+// escapeLike escapes the LIKE wildcards in s, and the escape character
+// itself, so it matches literally when used with ESCAPE likeEscape.
+func escapeLike(s string) string {
+	return strings.NewReplacer(
+		likeEscape, likeEscape+likeEscape,
+		`%`, likeEscape+`%`,
+		`_`, likeEscape+`_`,
+	).Replace(s)
+}
@@ -0,0 +1,54 @@
+package quotes
+
+import (
+	"testing"
+)
+
+func TestSearchLiteralText(t *testing.T) {
+	t.Parallel()
+
+	q := newTestDB(t)
+	quotes := []string{
+		`get 50%_off\ today`,
+		`get 50 percent off today`,
+		`get 50%xoff\ today`,
+		`get 50%_off today`,
+	}
+	for _, quote := range quotes {
+		if _, err := q.AddQuote("bob", quote); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		Text string
+		Want []string
+	}{
+		{Text: `50%_off\`, Want: []string{`get 50%_off\ today`}},
+		{Text: `50%_off`, Want: []string{`get 50%_off today`, `get 50%_off\ today`}},
+		{Text: `%`, Want: []string{`get 50%_off today`, `get 50%xoff\ today`, `get 50%_off\ today`}},
+		{Text: `\`, Want: []string{`get 50%xoff\ today`, `get 50%_off\ today`}},
+	}
+
+	for _, test := range tests {
+		found, total, err := q.Search(SearchOptions{Text: test.Text})
+		if err != nil {
+			t.Fatalf("%q: %v", test.Text, err)
+		}
+
+		got := make([]string, len(found))
+		for i, quote := range found {
+			got[i] = quote.Quote
+		}
+		if total != len(test.Want) || len(got) != len(test.Want) {
+			t.Errorf("%q: found %q (%d total), want %q", test.Text, got, total, test.Want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.Want[i] {
+				t.Errorf("%q: found %q, want %q", test.Text, got, test.Want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package quotes
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sessionCookie holds the signed session created by /login.
+const sessionCookie = "quotes_session"
+
+// signSession returns the cookie value of a session for user that expires
+// at expires. It's the user and expiry followed by their hmac.
+func (q *QuoteDB) signSession(user string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user)) + "." +
+		strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + q.sessionMAC(payload)
+}
+
+// sessionMAC signs payload with the session secret.
+func (q *QuoteDB) sessionMAC(payload string) string {
+	mac := hmac.New(sha256.New, q.sessionSecret)
+	_, _ = mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sessionUser returns the user of the request's session cookie, ok is false
+// if sessions are disabled or the cookie is missing, forged or expired.
+func (q *QuoteDB) sessionUser(r *http.Request) (user string, ok bool) {
+	if !q.webauth || q.sessionTTL <= 0 {
+		return "", false
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	i := strings.LastIndexByte(cookie.Value, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := cookie.Value[:i], cookie.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(q.sessionMAC(payload))) {
+		return "", false
+	}
+
+	parts := strings.SplitN(payload, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	name, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return "", false
+	}
+
+	// Sessions of a user that's no longer configured are not honored.
+	if subtle.ConstantTimeCompare(name, []byte(q.webuser)) != 1 {
+		return "", false
+	}
+
+	return string(name), true
+}
+
+// loginData is what the login page is rendered with.
+type loginData struct {
+	Base   string
+	CSRF   string
+	Failed bool
+}
+
+// quotesLogin shows the login form and creates a session when it's posted
+// with the right credentials. Like the vote forms the login form carries a
+// csrf token, so other sites can't log visitors in as someone else.
+func (q *QuoteDB) quotesLogin(w http.ResponseWriter, r *http.Request) {
+	data := loginData{Base: q.basePath}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if !validCSRF(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if q.validLogin(r.PostFormValue("user"), r.PostFormValue("password")) {
+			expires := time.Now().Add(q.sessionTTL)
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    q.signSession(q.webuser, expires),
+				Path:     q.basePath + "/",
+				Expires:  expires,
+				HttpOnly: true,
+				Secure:   q.secureRequest(r),
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, q.basePath+"/", http.StatusSeeOther)
+			return
+		}
+
+		data.Failed = true
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := csrfToken(w, r, q.basePath+"/")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to create csrf token", err)
+		return
+	}
+	data.CSRF = token
+
+	buf := &bytes.Buffer{}
+	if err = loginTmpl.Execute(buf, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to execute login template", err)
+		return
+	}
+
+	if data.Failed {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	_, _ = io.Copy(w, buf)
+}
+
+// quotesLogout ends the session by clearing its cookie, it must be posted
+// with the csrf token so other sites can't log visitors out. Browsers keep
+// sending basic auth they've been given regardless.
+func (q *QuoteDB) quotesLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !validCSRF(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     q.basePath + "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   q.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, q.basePath+"/login", http.StatusSeeOther)
+}
+
+var loginTmpl = template.Must(template.New("login").Parse(loginPage))
+
+const loginPage = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>Quotes - Log in</title>
+    <meta charset="utf-8">
+    <link rel="icon" href="{{.Base}}/favicon.ico">
+    <style>
+      body { font-family: sans-serif; margin: 4em auto; width: 20em; }
+      label, input, button { display: block; width: 100%; margin-bottom: 0.5em; }
+      .failed { color: #c33; }
+    </style>
+  </head>
+  <body>
+    <form method="post" action="{{.Base}}/login">
+      <input type="hidden" name="csrf" value="{{.CSRF}}">
+      {{if .Failed}}<p class="failed">Wrong user or password.</p>{{end}}
+      <label for="user">User</label>
+      <input id="user" name="user" autocomplete="username" autofocus>
+      <label for="password">Password</label>
+      <input id="password" name="password" type="password" autocomplete="current-password">
+      <button>Log in</button>
+    </form>
+  </body>
+</html>
+`
@@ -0,0 +1,143 @@
+package quotes
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// similarCandidates bounds how many quotes SimilarQuotes compares the quote
+// against, those sharing a tag with it are picked first and then the
+// newest.
+const similarCandidates = 1000
+
+// similarMinScore is the least similarity a quote without shared tags needs
+// to be suggested by SimilarQuotes.
+const similarMinScore = 0.2
+
+const (
+	sqlSharedTagsOf = `SELECT tag FROM tags WHERE quote_id = ?`
+
+	sqlGetSharedTagCounts = `SELECT quote_id, COUNT(*) FROM tags ` +
+		`WHERE quote_id != ? AND tag IN (` + sqlSharedTagsOf + `) GROUP BY quote_id;`
+	sqlGetSimilarCandidates = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`WHERE q.id != ? AND q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY q.id IN (SELECT quote_id FROM tags WHERE tag IN (` + sqlSharedTagsOf + `)) desc, q.id desc LIMIT ?;`
+)
+
+// SimilarQuotes suggests up to limit quotes related to the quote id, the
+// most similar first. Quotes are related when they share tags or their text
+// is alike, each shared tag counts as much as identical text. Quotes below
+// the visibility threshold are never suggested and fewer than limit are
+// returned when there aren't enough related quotes. It returns
+// ErrQuoteNotFound if there is no such quote.
+func (q *QuoteDB) SimilarQuotes(id, limit int) ([]Quote, error) {
+	quote, err := q.GetQuote(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrQuoteNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return make([]Quote, 0), nil
+	}
+
+	shared, err := q.sharedTagCounts(id)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := q.queryQuotes(sqlGetSimilarCandidates, id, id, similarCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		quote Quote
+		score float64
+	}
+
+	grams := trigrams(quote.Quote)
+	similar := make([]scored, 0)
+	for _, c := range candidates {
+		textScore := trigramSimilarity(grams, trigrams(c.Quote))
+		if shared[c.ID] == 0 && textScore < similarMinScore {
+			continue
+		}
+		similar = append(similar, scored{quote: c, score: float64(shared[c.ID]) + textScore})
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].score > similar[j].score
+	})
+
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	quotes := make([]Quote, len(similar))
+	for i, s := range similar {
+		quotes[i] = s.quote
+	}
+
+	return quotes, nil
+}
+
+// sharedTagCounts returns how many tags other quotes share with the quote
+// id, keyed by their id.
+func (q *QuoteDB) sharedTagCounts(id int) (map[int]int, error) {
+	rows, err := q.db.Query(sqlGetSharedTagCounts, id, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count shared tags: %w", dbError(err))
+	}
+
+	shared := make(map[int]int)
+	for rows.Next() {
+		var quoteID, count int
+		if err = rows.Scan(&quoteID, &count); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan tags (%w) but also close tags: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan tags: %w", dbError(err))
+		}
+		shared[quoteID] = count
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing tag rows: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all tag rows: %w", dbError(err))
+	}
+
+	return shared, nil
+}
+
+// trigrams returns the set of three letter sequences in the lowercased
+// words of text, words are padded so short words have trigrams too.
+func trigrams(text string) map[string]struct{} {
+	grams := make(map[string]struct{})
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+	return grams
+}
+
+// trigramSimilarity is the share of trigrams a and b have in common, from 0
+// for none to 1 for the same set.
+func trigramSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for g := range a {
+		if _, ok := b[g]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
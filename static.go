@@ -0,0 +1,64 @@
+package quotes
+
+import (
+	"embed"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// staticFiles are the assets served when no static directory is configured
+// or the configured one does not have the file, like the favicon.
+//
+//go:embed static
+var staticFiles embed.FS
+
+// staticFS returns the file systems static files are looked up in, in order.
+func (q *QuoteDB) staticFS() []fs.FS {
+	embedded, _ := fs.Sub(staticFiles, "static")
+	if len(q.staticDir) == 0 {
+		return []fs.FS{embedded}
+	}
+	return []fs.FS{os.DirFS(q.staticDir), embedded}
+}
+
+// quotesStatic serves /static/{name} from the static files.
+func (q *QuoteDB) quotesStatic(w http.ResponseWriter, r *http.Request) {
+	if !q.serveStatic(w, r, strings.TrimPrefix(r.URL.Path, "/static/")) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveStatic writes the named static file, it returns false without writing
+// anything if there is no such file.
+func (q *QuoteDB) serveStatic(w http.ResponseWriter, r *http.Request, name string) bool {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || !fs.ValidPath(name) {
+		return false
+	}
+
+	for _, fsys := range q.staticFS() {
+		f, err := fsys.Open(name)
+		if err != nil {
+			continue
+		}
+
+		info, err := f.Stat()
+		content, ok := f.(io.ReadSeeker)
+		if err != nil || info.IsDir() || !ok {
+			_ = f.Close()
+			continue
+		}
+
+		http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+		if err = f.Close(); err != nil {
+			q.logError(r, "Failed to close static file", err)
+		}
+		return true
+	}
+
+	return false
+}
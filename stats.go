@@ -0,0 +1,112 @@
+package quotes
+
+import (
+	"fmt"
+	"time"
+)
+
+// secondsPerDay is the width of the buckets of QuotesPerDay.
+const secondsPerDay = 24 * 60 * 60
+
+const (
+	sqlGetVoteStats = `SELECT COUNT(*), COUNT(DISTINCT v.voter) FROM votes AS v ` +
+		`INNER JOIN quotes AS q ON q.id = v.quote_id ` +
+		`WHERE q.deleted_at IS NULL AND q.status = 'approved';`
+	sqlGetScoreBuckets = `SELECT COUNT(*), ` +
+		`COALESCE(SUM(score < 0), 0), ` +
+		`COALESCE(SUM(score = 0), 0), ` +
+		`COALESCE(SUM(score BETWEEN 1 AND 5), 0), ` +
+		`COALESCE(SUM(score > 5), 0) ` +
+		`FROM (SELECT ` + sqlNetScore + ` AS score ` +
+		`FROM quotes AS q WHERE q.deleted_at IS NULL AND q.status = 'approved');`
+	sqlGetPerDay = `SELECT date / 86400 AS day, COUNT(*) FROM quotes ` +
+		`WHERE deleted_at IS NULL AND status = 'approved' AND date >= ? AND date < ? ` +
+		`GROUP BY day ORDER BY day asc;`
+)
+
+// VoteStats describes how much voting the quotes get, see GetVoteStats.
+type VoteStats struct {
+	// Votes is the number of votes cast, regardless of their weight.
+	Votes int `json:"votes"`
+	// Voters is the number of distinct voters.
+	Voters int `json:"voters"`
+	// AvgVotesPerQuote is Votes divided by the number of quotes.
+	AvgVotesPerQuote float64 `json:"avg_votes_per_quote"`
+
+	// The number of quotes by net score (upvotes - downvotes).
+	Negative int `json:"negative"`
+	Zero     int `json:"zero"`
+	Low      int `json:"low"`  // 1 to 5
+	High     int `json:"high"` // 6 and up
+}
+
+// GetVoteStats summarizes the votes on the visible quotes, quotes below the
+// visibility threshold are included so the negative bucket means something.
+func (q *QuoteDB) GetVoteStats() (VoteStats, error) {
+	var stats VoteStats
+	if err := q.db.QueryRow(sqlGetVoteStats).Scan(&stats.Votes, &stats.Voters); err != nil {
+		return VoteStats{}, fmt.Errorf("failed to count votes: %w", dbError(err))
+	}
+
+	var nQuotes int
+	err := q.db.QueryRow(sqlGetScoreBuckets).Scan(&nQuotes,
+		&stats.Negative, &stats.Zero, &stats.Low, &stats.High)
+	if err != nil {
+		return VoteStats{}, fmt.Errorf("failed to count scores: %w", dbError(err))
+	}
+
+	if nQuotes != 0 {
+		stats.AvgVotesPerQuote = float64(stats.Votes) / float64(nQuotes)
+	}
+	return stats, nil
+}
+
+// DayCount is the number of quotes added on a UTC day, see QuotesPerDay.
+type DayCount struct {
+	Day   time.Time `json:"day"`
+	Count int       `json:"count"`
+}
+
+// QuotesPerDay counts the visible quotes added on each UTC day from start's
+// day to end's day, both included. Days without quotes are returned with a
+// count of 0 so the series has no gaps, it's empty when end is before start.
+func (q *QuoteDB) QuotesPerDay(start, end time.Time) ([]DayCount, error) {
+	first := start.Unix() / secondsPerDay
+	last := end.Unix() / secondsPerDay
+	if first > last {
+		return make([]DayCount, 0), nil
+	}
+
+	counts := make([]DayCount, last-first+1)
+	for i := range counts {
+		counts[i].Day = time.Unix((first+int64(i))*secondsPerDay, 0).UTC()
+	}
+
+	rows, err := q.db.Query(sqlGetPerDay, first*secondsPerDay, (last+1)*secondsPerDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count quotes per day: %w", dbError(err))
+	}
+
+	for rows.Next() {
+		var day int64
+		var count int
+		if err = rows.Scan(&day, &count); err != nil {
+			if cerr := rows.Close(); cerr != nil {
+				return nil, fmt.Errorf("failed to scan days (%w) but also close days: %v", dbError(err), cerr)
+			}
+			return nil, fmt.Errorf("failed to scan days: %w", dbError(err))
+		}
+		if day >= first && day <= last {
+			counts[day-first].Count = count
+		}
+	}
+
+	if err = rows.Close(); err != nil {
+		return nil, fmt.Errorf("error closing rows in quotes per day: %w", dbError(err))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading all rows: %w", dbError(err))
+	}
+
+	return counts, nil
+}
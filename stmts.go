@@ -0,0 +1,76 @@
+package quotes
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// stmts are the statements run most often, they're prepared once when the
+// database is opened rather than parsed on every call. Any of them is nil if
+// it could not be prepared, the plain query is run instead.
+type stmts struct {
+	getByID   *sql.Stmt
+	getRandom *sql.Stmt
+	hasVote   *sql.Stmt
+	vote      *sql.Stmt
+}
+
+// prepare prepares the statements, failures are only logged since every use
+// falls back to the unprepared query.
+func (q *QuoteDB) prepare() {
+	prepare := func(query string) *sql.Stmt {
+		stmt, err := q.db.Prepare(q.withThreshold(query))
+		if err != nil {
+			q.logger.Error("Failed to prepare statement", "sql", query, "err", err)
+			return nil
+		}
+		return stmt
+	}
+
+	q.stmts = stmts{
+		getByID:   prepare(sqlGetByID),
+		getRandom: prepare(sqlGetRandom),
+		hasVote:   prepare(sqlHasVote),
+		vote:      prepare(sqlVote),
+	}
+}
+
+// close closes every prepared statement, returning the first error.
+func (s *stmts) close() error {
+	var firstErr error
+	for _, stmt := range []*sql.Stmt{s.getByID, s.getRandom, s.hasVote, s.vote} {
+		if stmt == nil {
+			continue
+		}
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close statement: %w", dbError(err))
+		}
+	}
+
+	*s = stmts{}
+	return firstErr
+}
+
+// queryRow runs stmt if it was prepared and query otherwise.
+func (q *QuoteDB) queryRow(stmt *sql.Stmt, query string, args ...interface{}) *sql.Row {
+	if stmt != nil {
+		return stmt.QueryRow(args...)
+	}
+	return q.db.QueryRow(q.withThreshold(query), args...)
+}
+
+// txQueryRow runs stmt in tx if it was prepared and query otherwise.
+func txQueryRow(tx *sql.Tx, stmt *sql.Stmt, query string, args ...interface{}) *sql.Row {
+	if stmt != nil {
+		return tx.Stmt(stmt).QueryRow(args...)
+	}
+	return tx.QueryRow(query, args...)
+}
+
+// txExec runs stmt in tx if it was prepared and query otherwise.
+func txExec(tx *sql.Tx, stmt *sql.Stmt, query string, args ...interface{}) (sql.Result, error) {
+	if stmt != nil {
+		return tx.Stmt(stmt).Exec(args...)
+	}
+	return tx.Exec(query, args...)
+}
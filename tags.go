@@ -0,0 +1,62 @@
+package quotes
+
+import (
+	"database/sql"
+	"strings"
+)
+
+const (
+	sqlCreateTagsTable = `CREATE TABLE IF NOT EXISTS tags (` +
+		`quote_id INTEGER NOT NULL,` +
+		`tag TEXT NOT NULL,` +
+		`PRIMARY KEY (quote_id, tag),` +
+		`FOREIGN KEY (quote_id) REFERENCES quotes (id))`
+	sqlTagIndex = `CREATE INDEX IF NOT EXISTS tagstag ON tags (tag);`
+
+	sqlAddTag    = `INSERT OR IGNORE INTO tags (quote_id, tag) VALUES (?, ?);`
+	sqlRemoveTag = `DELETE FROM tags WHERE quote_id = ? AND tag = ?;`
+	sqlDelTags   = `DELETE FROM tags WHERE quote_id = ?;`
+	sqlPurgeTags = `DELETE FROM tags WHERE quote_id IN (SELECT id FROM quotes WHERE deleted_at IS NOT NULL AND deleted_at < ?);`
+
+	sqlGetRandomByTag = `SELECT ` + sqlQuoteColumns + `FROM quotes as q ` +
+		`INNER JOIN tags as t ON t.quote_id = q.id ` +
+		`WHERE t.tag = ? AND q.deleted_at IS NULL AND q.status = 'approved' AND (upvotes - downvotes) > ` + sqlThreshold + ` ` +
+		`ORDER BY RANDOM() LIMIT 1;`
+)
+
+// normalizeTag lowercases and trims a tag so lookups are case insensitive.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// AddTag tags a quote, adding a tag the quote already has is not an error.
+func (q *QuoteDB) AddTag(id int, tag string) error {
+	_, err := q.db.Exec(sqlAddTag, id, normalizeTag(tag))
+	return dbError(err)
+}
+
+// RemoveTag removes a tag from a quote, it returns true iff the quote had the
+// tag.
+func (q *QuoteDB) RemoveTag(id int, tag string) (bool, error) {
+	res, err := q.db.Exec(sqlRemoveTag, id, normalizeTag(tag))
+	if err != nil {
+		return false, dbError(err)
+	}
+
+	r, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError(err)
+	}
+	return r == 1, nil
+}
+
+// RandomQuoteByTag gets a random quote carrying the tag, it returns
+// ErrNoQuotes if there are no eligible quotes with that tag.
+func (q *QuoteDB) RandomQuoteByTag(tag string) (quote Quote, err error) {
+	quote, err = scanQuote(q.db.QueryRow(q.withThreshold(sqlGetRandomByTag), normalizeTag(tag)))
+	if err == sql.ErrNoRows {
+		return quote, ErrNoQuotes
+	}
+
+	return quote, err
+}
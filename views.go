@@ -0,0 +1,139 @@
+package quotes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const sqlAddViews = `UPDATE quotes SET views = views + ? WHERE id = ?;`
+
+// viewCounter holds views that have not been written to the database yet.
+type viewCounter struct {
+	sync.Mutex
+	pending map[int]int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// IncrementView counts a view of a quote, it does nothing unless view
+// tracking is enabled with WithViewTracking. Views may be held in memory
+// until the next FlushViews.
+func (q *QuoteDB) IncrementView(id int) error {
+	if !q.trackViews {
+		return nil
+	}
+
+	if q.viewFlushEvery <= 0 {
+		if _, err := q.db.Exec(sqlAddViews, 1, id); err != nil {
+			return fmt.Errorf("failed to add view: %w", dbError(err))
+		}
+		return nil
+	}
+
+	q.views.Lock()
+	if q.views.pending == nil {
+		q.views.pending = make(map[int]int)
+	}
+	q.views.pending[id]++
+	q.views.Unlock()
+	return nil
+}
+
+// FlushViews writes the views held in memory to the database. It's called
+// periodically and by Close so it only needs to be called to see the counts
+// sooner.
+func (q *QuoteDB) FlushViews() error {
+	q.views.Lock()
+	pending := q.views.pending
+	q.views.pending = nil
+	q.views.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		q.requeueViews(pending)
+		return dbError(err)
+	}
+
+	runTx := func() error {
+		for id, n := range pending {
+			if _, err = tx.Exec(sqlAddViews, n, id); err != nil {
+				return fmt.Errorf("failed to add views: %w", dbError(err))
+			}
+		}
+		return nil
+	}
+
+	if err = runTx(); err != nil {
+		q.requeueViews(pending)
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return fmt.Errorf("failed to flush views: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		q.requeueViews(pending)
+		return fmt.Errorf("failed to commit flush views: %w", dbError(err))
+	}
+
+	return nil
+}
+
+// requeueViews puts views that failed to be written back to be retried.
+func (q *QuoteDB) requeueViews(views map[int]int) {
+	q.views.Lock()
+	defer q.views.Unlock()
+
+	if q.views.pending == nil {
+		q.views.pending = make(map[int]int, len(views))
+	}
+	for id, n := range views {
+		q.views.pending[id] += n
+	}
+}
+
+// startViewFlusher flushes the views every viewFlushEvery until
+// stopViewFlusher is called.
+func (q *QuoteDB) startViewFlusher() {
+	if !q.trackViews || q.viewFlushEvery <= 0 {
+		return
+	}
+
+	q.views.stop = make(chan struct{})
+	q.views.done = make(chan struct{})
+	go func() {
+		defer close(q.views.done)
+
+		ticker := time.NewTicker(q.viewFlushEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := q.FlushViews(); err != nil {
+					q.logger.Error("Failed to flush views", "err", err)
+				}
+			case <-q.views.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopViewFlusher stops the periodic flush and writes what's left.
+func (q *QuoteDB) stopViewFlusher() error {
+	if q.views.stop != nil {
+		close(q.views.stop)
+		<-q.views.done
+		q.views.stop = nil
+	}
+
+	return q.FlushViews()
+}
@@ -0,0 +1,73 @@
+package quotes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// HashVoter derives a stable voter name from something identifying like an
+// ip address so that anonymous voters still only get one vote per quote
+// without storing the raw value in the votes table. The salt must be kept
+// secret and persisted, changing it gives every anonymous voter a new
+// identity and so a fresh set of votes.
+func HashVoter(salt, raw string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	_, _ = mac.Write([]byte(raw))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+const (
+	// sqlRemoveVoterScores takes the voter's votes off the scores stored on
+	// the quotes they voted on, it must run before their votes are deleted.
+	sqlRemoveVoterScores = `UPDATE quotes SET ` +
+		`upvotes = upvotes - (SELECT COALESCE(SUM(vote), 0) FROM votes WHERE quote_id = quotes.id AND voter = ? AND vote > 0), ` +
+		`downvotes = downvotes - (SELECT COALESCE(-SUM(vote), 0) FROM votes WHERE quote_id = quotes.id AND voter = ? AND vote < 0) ` +
+		`WHERE id IN (SELECT quote_id FROM votes WHERE voter = ?);`
+	sqlDelVoterVotes = `DELETE FROM votes WHERE voter = ?;`
+)
+
+// DeleteVoterData deletes every vote the voter has cast, for when they ask
+// for their data to be deleted, and returns how many votes were deleted.
+// The quotes themselves are kept but their vote counts change as if the
+// voter had never voted. Favorites, reactions and reports are left alone.
+func (q *QuoteDB) DeleteVoterData(voter string) (int, error) {
+	tx, err := q.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: false})
+	if err != nil {
+		return 0, dbError(err)
+	}
+
+	var deleted int64
+	runTx := func() error {
+		if _, err = tx.Exec(sqlRemoveVoterScores, voter, voter, voter); err != nil {
+			return fmt.Errorf("failed to update scores: %w", dbError(err))
+		}
+
+		var res sql.Result
+		res, err = tx.Exec(sqlDelVoterVotes, voter)
+		if err != nil {
+			return fmt.Errorf("failed to delete votes: %w", dbError(err))
+		}
+		if deleted, err = res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed getting rows affected: %w", dbError(err))
+		}
+
+		return nil
+	}
+
+	if err = runTx(); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return 0, fmt.Errorf("failed to rollback (%w) after error: %w", dbError(rerr), err)
+		}
+		return 0, fmt.Errorf("failed to delete voter data: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit delete voter data: %w", dbError(err))
+	}
+
+	return int(deleted), nil
+}
@@ -2,78 +2,669 @@ package quotes
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
-	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// rgxSplitQuote finds irc style "<nick> message" lines, the <nick> part is
+// not html and must never be treated as such.
 var rgxSplitQuote = regexp.MustCompile(`<[^>]+>[^<]+`)
 
+// splitEm splits a quote into its lines for display. Quotes are split on
+// newlines and each line is further split into its "<nick> message" parts so
+// irc logs display one message per line whether they were pasted with
+// newlines or not. Blank lines are dropped.
+//
+// The returned values are plain strings so html/template escapes them as
+// text, they must never be converted to template.HTML since quote bodies are
+// user supplied. renderMarkdown is safe to use on them as it escapes first.
 func splitEm(q string) []string {
-	matches := rgxSplitQuote.FindAllString(q, -1)
+	if !strings.ContainsAny(q, "\r\n") {
+		return splitNicks(q)
+	}
+
+	var split []string
+	for _, line := range strings.FieldsFunc(q, func(r rune) bool { return r == '\r' || r == '\n' }) {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		split = append(split, splitNicks(line)...)
+	}
+
+	if split == nil {
+		return []string{q}
+	}
+	return split
+}
+
+// splitNicks splits a single line into its "<nick> message" parts.
+func splitNicks(line string) []string {
+	matches := rgxSplitQuote.FindAllString(line, -1)
 	if matches != nil {
 		return matches
 	}
 
-	return []string{q}
+	return []string{line}
 }
 
-var tmpl = template.Must(template.New("quotes").Funcs(template.FuncMap{
+// defaultDateLayout is how fmtDate formats dates unless WithDateFormat is
+// used, dates are shown in UTC by default.
+const defaultDateLayout = "2006-01-02 15:04:05"
+
+// templateFuncs are available to the built-in template and any template
+// created with ParseTemplate.
+var templateFuncs = template.FuncMap{
 	"fmtDate": func(date time.Time) string {
-		return date.Format("2006-01-02 15:04:05")
+		return date.Format(defaultDateLayout)
 	},
 	"sub": func(a, b int) string {
 		return fmt.Sprint(a - b)
 	},
-	"splitEm": splitEm,
-}).Parse(index))
+	"splitEm":    splitEm,
+	"pathEscape": url.PathEscape,
+	"isURL":      isURL,
+	"length":     Quote.Length,
+	"wordCount":  Quote.WordCount,
+	// renderMarkdown is the one function that returns html, it's safe
+	// because it escapes the quote before adding its few tags.
+	"renderMarkdown": renderMarkdown,
+}
+
+// isURL reports whether s is an absolute http or https url.
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && len(u.Host) != 0
+}
+
+var tmpl = template.Must(ParseTemplate(index))
+
+// ParseTemplate parses a replacement for the built-in page template, see
+// WithTemplate for what the template is given. The following functions are
+// available to it:
+//
+//	fmtDate    time.Time -> string   formats a date, see WithDateFormat
+//	sub        int, int -> string    subtracts the second argument from the first
+//	splitEm    string -> []string    splits an irc style quote into its lines
+//	pathEscape string -> string      escapes a string for use in a url path
+//	isURL      string -> bool        reports if a string is an http(s) url
+//	length     Quote -> int          the number of characters in a quote
+//	wordCount  Quote -> int          the number of words in a quote
+//	renderMarkdown string -> template.HTML
+//	                                 renders a quote's bold, italics and code
+//	                                 spans, escaping the quote first
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("quotes").Funcs(templateFuncs).Parse(text)
+}
+
+// indexData is what the page template is rendered with.
+type indexData struct {
+	NQuotes      int
+	Quotes       []Quote
+	AllHref      template.HTMLAttr
+	VotesortHref template.HTMLAttr
+	// Base is the path prefix links must start with, see WithBasePath.
+	Base string
+	// Markdown is true if quotes should be shown with renderMarkdown.
+	Markdown bool
+
+	// Page is the page being shown out of TotalPages with PerPage quotes
+	// each, the hrefs are empty when there's no such page.
+	Page       int
+	PerPage    int
+	TotalPages int
+	PrevHref   template.HTMLAttr
+	NextHref   template.HTMLAttr
+	Pages      []pageLink
+
+	// Voter is the authenticated user, when it's empty voting is disabled.
+	Voter   string
+	MyVotes map[int]int
+	CSRF    string
+}
+
+// pageLink is a link to one of the pages around the one being shown.
+type pageLink struct {
+	Number  int
+	Href    template.HTMLAttr
+	Current bool
+}
+
+// indexPerPage is how many quotes the index shows per page unless per_page
+// asks for a different number, pagerWidth is how many pages either side of
+// the current one the pager links to.
+const (
+	indexPerPage = 50
+	pagerWidth   = 3
+)
+
+// healthTimeout bounds how long /healthz waits on the database.
+const healthTimeout = 2 * time.Second
+
+// csrfCookie holds the per-session token that vote forms must echo back.
+const csrfCookie = "quotes_csrf"
+
+// render executes the page template into w with the given status. If the
+// request has a voter the data is filled in with what's needed to render the
+// vote forms. The status is only written once the page is ready so headers
+// set while rendering, like the csrf cookie, aren't lost and failures can
+// still respond with 500.
+func (q *QuoteDB) render(w http.ResponseWriter, r *http.Request, status int, data indexData) {
+	if voter := q.webVoter(r); len(voter) != 0 {
+		votes, err := q.voterVotes(voter)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			q.logError(r, "Failed to get votes", err)
+			return
+		}
+
+		token, err := csrfToken(w, r, q.basePath+"/")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			q.logError(r, "Failed to create csrf token", err)
+			return
+		}
+
+		data.Voter = voter
+		data.MyVotes = votes
+		data.CSRF = token
+	}
+
+	data.Base = q.basePath
+	data.Markdown = q.markdown
+
+	t := tmpl
+	if q.tmpl != nil {
+		t = q.tmpl
+	}
 
-// StartServer starts a webserver to listen on.
-func (q *QuoteDB) StartServer(address string) {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to execute template", err)
+		return
+	}
+
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	_, _ = io.Copy(w, buf)
+}
+
+// setupTemplate gives the page template the date format set by
+// WithDateFormat, the template is cloned so others using it are unaffected.
+func (q *QuoteDB) setupTemplate() error {
+	if len(q.dateLayout) == 0 && q.dateLocation == nil {
+		return nil
+	}
+
+	var t *template.Template
+	if q.tmpl == nil {
+		// The built-in template may have been executed already which makes
+		// it impossible to clone.
+		t = template.Must(ParseTemplate(index))
+	} else {
+		var err error
+		if t, err = q.tmpl.Clone(); err != nil {
+			return fmt.Errorf("failed to clone template: %w", err)
+		}
+	}
+
+	q.tmpl = t.Funcs(template.FuncMap{"fmtDate": q.fmtDate})
+	return nil
+}
+
+// fmtDate formats a date with the layout and location set by
+// WithDateFormat.
+func (q *QuoteDB) fmtDate(date time.Time) string {
+	layout := q.dateLayout
+	if len(layout) == 0 {
+		layout = defaultDateLayout
+	}
+	if q.dateLocation != nil {
+		date = date.In(q.dateLocation)
+	}
+	return date.Format(layout)
+}
+
+// StartServer starts a webserver to listen on. The address is bound before
+// returning so an address that's in use, for example by StartTLSServer, is
+// reported as an error rather than only logged.
+func (q *QuoteDB) StartServer(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	srv := q.newServer(address)
 	go func() {
-		mux := http.NewServeMux()
-		mux.HandleFunc("/", q.quotesRoot)
-		http.ListenAndServe(address, mux)
+		err := srv.Serve(ln)
+		q.logger.Error("Web server stopped", "addr", address, "err", err)
 	}()
+
+	return nil
 }
 
-func (q *QuoteDB) quotesRoot(w http.ResponseWriter, r *http.Request) {
-	if len(q.webuser) != 0 || len(q.webhash) != 0 {
-		user, pwd, ok := r.BasicAuth()
-		if !ok || q.webuser != user || nil != bcrypt.CompareHashAndPassword(q.webhash, []byte(pwd)) {
-			w.Header().Set("WWW-Authenticate", "Basic realm=Quotes")
-			w.WriteHeader(http.StatusUnauthorized)
-			return
+// StartTLSServer is like StartServer but serves https using the certificate
+// and key in the given PEM files.
+func (q *QuoteDB) StartTLSServer(address, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	srv := q.newServer(address)
+	srv.TLSConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	go func() {
+		err := srv.ServeTLS(ln, "", "")
+		q.logger.Error("Web server stopped", "addr", address, "err", err)
+	}()
+
+	return nil
+}
+
+// newServer creates the http.Server that serves Handler.
+func (q *QuoteDB) newServer(address string) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           q.Handler(),
+		ReadHeaderTimeout: q.readHeaderTimeout,
+		ReadTimeout:       q.readTimeout,
+		WriteTimeout:      q.writeTimeout,
+		IdleTimeout:       q.idleTimeout,
+	}
+}
+
+// Handler returns the web pages and api that StartServer serves, for
+// mounting them into an existing server. It's configured by the same
+// options, like WithBasePath which the paths it's given must still include.
+//
+//	mux.Handle("/quotes/", qdb.Handler()) // with WithBasePath("/quotes")
+func (q *QuoteDB) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", q.quotesRoot)
+	mux.HandleFunc("/quote/", q.quotePermalink)
+	mux.HandleFunc("/author/", q.quotesByAuthor)
+	mux.HandleFunc("/c/", q.quotesCollection)
+	mux.HandleFunc("/random", q.quotesRandom)
+	mux.HandleFunc("/feed", q.quotesFeed)
+	mux.HandleFunc("/metrics", q.quotesMetrics)
+	mux.HandleFunc("/healthz", q.quotesHealth)
+	mux.HandleFunc("/api/search", q.apiSearch)
+	mux.HandleFunc("/api/quotes", q.apiQuotes)
+	mux.HandleFunc("/api/random", q.apiRandom)
+	mux.HandleFunc("/api/quotes/", q.apiQuote)
+	mux.HandleFunc("/api/stats/timeseries", q.apiTimeseries)
+	mux.HandleFunc("/static/", q.quotesStatic)
+	if q.webauth && q.sessionTTL > 0 {
+		mux.HandleFunc("/login", q.quotesLogin)
+		mux.HandleFunc("/logout", q.quotesLogout)
+	}
+
+	var handler http.Handler = mux
+	if len(q.basePath) != 0 {
+		// The handlers only ever see the path below the prefix so the
+		// index at /prefix/ is still matched as "/".
+		prefixed := http.NewServeMux()
+		prefixed.Handle(q.basePath+"/", http.StripPrefix(q.basePath, mux))
+		handler = prefixed
+	}
+	if len(q.allowedNets) != 0 {
+		handler = q.allowedHandler(handler)
+	}
+	if q.gzip {
+		handler = gzipHandler(handler)
+	}
+	if q.accessLog {
+		handler = q.accessLogHandler(handler)
+	}
+
+	return handler
+}
+
+// hashWebPass replaces the plaintext web password with its bcrypt hash.
+func (q *QuoteDB) hashWebPass() (err error) {
+	if q.webhash, err = bcrypt.GenerateFromPassword([]byte(q.webpass), q.webcost); err != nil {
+		return fmt.Errorf("failed to hash web password: %w", err)
+	}
+	q.webpass = ""
+	return nil
+}
+
+// checkAuth enforces basic auth when it's configured, it returns false and
+// writes the challenge if the request may not proceed. A valid session
+// cookie is accepted in place of basic auth when sessions are enabled.
+func (q *QuoteDB) checkAuth(w http.ResponseWriter, r *http.Request) bool {
+	if !q.webauth {
+		return true
+	}
+	if _, ok := q.sessionUser(r); ok {
+		return true
+	}
+
+	user, pwd, ok := r.BasicAuth()
+	if !ok || !q.validLogin(user, pwd) {
+		if q.sessionTTL > 0 && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			// Browsers are sent to the login page rather than the basic
+			// auth prompt.
+			http.Redirect(w, r, q.basePath+"/login", http.StatusSeeOther)
+			return false
 		}
+		w.Header().Set("WWW-Authenticate", "Basic realm=Quotes")
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
 	}
 
+	return true
+}
+
+// validLogin checks user and pwd against the configured web auth.
+func (q *QuoteDB) validLogin(user, pwd string) bool {
+	userOk := subtle.ConstantTimeCompare([]byte(q.webuser), []byte(user)) == 1
+	pwdOk := bcrypt.CompareHashAndPassword(q.webhash, []byte(pwd)) == nil
+	return userOk && pwdOk
+}
+
+// authUser returns the user the request is authenticated as, from the
+// session cookie or basic auth. It does not check the basic auth password,
+// checkAuth must have accepted the request.
+func (q *QuoteDB) authUser(r *http.Request) string {
+	if user, ok := q.sessionUser(r); ok {
+		return user
+	}
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
+func (q *QuoteDB) quotesRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
-		w.WriteHeader(http.StatusNotFound)
+		// Anything else at the root is a static file like /favicon.ico
+		if !q.serveStatic(w, r, r.URL.Path) {
+			w.WriteHeader(http.StatusNotFound)
+		}
 		return
 	}
 
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	if etag, err := q.indexETag(r); err != nil {
+		q.logError(r, "Failed to create etag", err)
+	} else {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	showAll := false
-	voteSort := false
+	order := ByID
 	query := r.URL.Query()
-	if query.Get("all") == "true" {
+	if queryBool(query, "all") {
 		showAll = true
 	}
-	if query.Get("votesort") == "true" {
-		voteSort = true
+	if queryBool(query, "votesort") {
+		order = ByScore
+	}
+
+	page := queryInt(query, "page", 1, searchMaxPage)
+	perPage := queryInt(query, "per_page", indexPerPage, searchMaxPerPage)
+	quotes, total, err := q.GetPage(page, perPage, !showAll, order)
+	if err == nil && len(quotes) == 0 && page > 1 {
+		// Past the last page, show the last page instead.
+		page = (total + perPage - 1) / perPage
+		if page < 1 {
+			page = 1
+		}
+		quotes, total, err = q.GetPage(page, perPage, !showAll, order)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to get all the quotes", err)
+		return
+	}
+
+	allQuery := cloneQuery(query)
+	allQuery.Set("all", "true")
+	allQuery.Del("page")
+	votesortQuery := cloneQuery(query)
+	votesortQuery.Set("votesort", "true")
+	votesortQuery.Del("page")
+
+	data := indexData{
+		NQuotes:      total,
+		Quotes:       quotes,
+		AllHref:      q.href("/", allQuery),
+		VotesortHref: q.href("/", votesortQuery),
+	}
+	q.paginate(&data, query, page, perPage, total)
+
+	q.render(w, r, http.StatusOK, data)
+}
+
+// paginate fills in the pager of data, the page links keep every other
+// query parameter of the request.
+func (q *QuoteDB) paginate(data *indexData, query url.Values, page, perPage, total int) {
+	data.Page = page
+	data.PerPage = perPage
+	data.TotalPages = (total + perPage - 1) / perPage
+	if data.TotalPages < 1 {
+		data.TotalPages = 1
+	}
+
+	pageHref := func(n int) template.HTMLAttr {
+		pageQuery := cloneQuery(query)
+		pageQuery.Set("page", strconv.Itoa(n))
+		return q.href("/", pageQuery)
+	}
+
+	if page > 1 {
+		data.PrevHref = pageHref(page - 1)
+	}
+	if page < data.TotalPages {
+		data.NextHref = pageHref(page + 1)
+	}
+
+	first, last := page-pagerWidth, page+pagerWidth
+	if first < 1 {
+		first = 1
+	}
+	if last > data.TotalPages {
+		last = data.TotalPages
+	}
+	for n := first; n <= last; n++ {
+		data.Pages = append(data.Pages, pageLink{Number: n, Href: pageHref(n), Current: n == page})
+	}
+}
+
+// quotesHealth pings the database for load balancer health checks, it does
+// not require auth.
+func (q *QuoteDB) quotesHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := q.Ping(ctx); err != nil {
+		q.logError(r, "Health check failed", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "unavailable"})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Status string `json:"status"`
+		Quotes int    `json:"quotes"`
+	}{"ok", q.NQuotes()})
+}
+
+// quotePermalink renders a single quote at /quote/{id}, as an image at
+// /quote/{id}/card.svg and accepts votes posted to
+// /quote/{id}/{upvote,downvote,unvote}
+func (q *QuoteDB) quotePermalink(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/quote/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		if parts[1] == "card.svg" {
+			q.quoteCard(w, r, id)
+			return
+		}
+		q.quoteVote(w, r, id, parts[1])
+		return
+	}
+
+	quote, err := q.GetQuote(id)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to get quote", err)
+		return
+	}
+
+	if err = q.IncrementView(id); err != nil {
+		q.logError(r, "Failed to count view", err)
+	}
+
+	data := indexData{
+		NQuotes:      1,
+		Quotes:       []Quote{quote},
+		AllHref:      q.href("/", url.Values{"all": {"true"}}),
+		VotesortHref: q.href("/", url.Values{"votesort": {"true"}}),
+	}
+
+	q.render(w, r, http.StatusOK, data)
+}
+
+// quotesRandom shows a random quote, when there are none the page says so
+// like the index does.
+func (q *QuoteDB) quotesRandom(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	data := indexData{
+		AllHref:      q.href("/", url.Values{"all": {"true"}}),
+		VotesortHref: q.href("/", url.Values{"votesort": {"true"}}),
+	}
+
+	quote, err := q.RandomQuote()
+	if err == nil {
+		data.NQuotes = 1
+		data.Quotes = []Quote{quote}
+	} else if err != sql.ErrNoRows {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to get random quote", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	q.render(w, r, http.StatusOK, data)
+}
+
+// quotesByAuthor lists the quotes of the author named by /author/{name}
+func (q *QuoteDB) quotesByAuthor(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	author, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/author/"))
+	if err != nil || len(author) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	showAll := queryBool(query, "all")
+
+	quotes, err := q.GetByAuthor(author, !showAll)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		q.logError(r, "Failed to get quotes by author", err)
+		return
+	}
+
+	allQuery := cloneQuery(query)
+	allQuery.Set("all", "true")
+	path := "/author/" + url.PathEscape(author)
+
+	data := indexData{
+		NQuotes:      len(quotes),
+		Quotes:       quotes,
+		AllHref:      q.href(path, allQuery),
+		VotesortHref: q.href("/", url.Values{"votesort": {"true"}}),
+	}
+
+	status := http.StatusOK
+	if len(quotes) == 0 {
+		status = http.StatusNotFound
+	}
+
+	q.render(w, r, status, data)
+}
+
+// quotesCollection lists the quotes of the collection named by /c/{name}/,
+// it's the only page limited to a single collection.
+func (q *QuoteDB) quotesCollection(w http.ResponseWriter, r *http.Request) {
+	if !q.checkAuth(w, r) {
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/c/"), "/")
+	collection, err := url.PathUnescape(name)
+	if err != nil || len(collection) == 0 || strings.Contains(collection, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	quotes, err := q.GetAll(!showAll)
+	query := r.URL.Query()
+	showAll := queryBool(query, "all")
+	order := ByID
+	if queryBool(query, "votesort") {
+		order = ByScore
+	}
+
+	quotes, err := q.GetAllInOrdered(collection, !showAll, order)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("Failed to get all the quotes:", err)
+		q.logError(r, "Failed to get quotes in collection", err)
 		return
 	}
 
@@ -81,38 +672,150 @@ func (q *QuoteDB) quotesRoot(w http.ResponseWriter, r *http.Request) {
 	allQuery.Set("all", "true")
 	votesortQuery := cloneQuery(query)
 	votesortQuery.Set("votesort", "true")
+	path := "/c/" + url.PathEscape(collection) + "/"
 
-	data := struct {
-		NQuotes      int
-		Quotes       []Quote
-		AllHref      template.HTMLAttr
-		VotesortHref template.HTMLAttr
-	}{
+	data := indexData{
 		NQuotes:      len(quotes),
 		Quotes:       quotes,
-		AllHref:      template.HTMLAttr(fmt.Sprintf(`href="/?%s"`, allQuery.Encode())),
-		VotesortHref: template.HTMLAttr(fmt.Sprintf(`href="/?%s"`, votesortQuery.Encode())),
+		AllHref:      q.href(path, allQuery),
+		VotesortHref: q.href(path, votesortQuery),
 	}
 
-	if voteSort {
-		sort.Slice(data.Quotes, func(i, j int) bool {
-			iquote := data.Quotes[i]
-			jquote := data.Quotes[j]
-			ivotes := iquote.Upvotes - iquote.Downvotes
-			jvotes := jquote.Upvotes - jquote.Downvotes
+	status := http.StatusOK
+	if len(quotes) == 0 {
+		status = http.StatusNotFound
+	}
 
-			return ivotes > jvotes || (ivotes == jvotes && iquote.ID > jquote.ID)
-		})
+	q.render(w, r, status, data)
+}
+
+// quoteVote applies a vote posted from one of the vote forms and redirects
+// back to the page it came from.
+func (q *QuoteDB) quoteVote(w http.ResponseWriter, r *http.Request, id int, action string) {
+	var vote func(int, string) (bool, error)
+	switch action {
+	case "upvote":
+		vote = q.Upvote
+	case "downvote":
+		vote = q.Downvote
+	case "unvote":
+		vote = q.Unvote
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	buf := &bytes.Buffer{}
-	if err = tmpl.Execute(buf, data); err != nil {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	voter := q.webVoter(r)
+	if len(voter) == 0 {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if !validCSRF(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if _, err := vote(id, voter); err == ErrRateLimited {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	} else if errors.Is(err, ErrQuoteNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Println("Failed to execute template:", err)
+		q.logError(r, "Failed to vote", err)
 		return
 	}
 
-	_, _ = io.Copy(w, buf)
+	redirect := q.basePath + "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && len(ref.Path) != 0 {
+		redirect = ref.RequestURI()
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// webVoter returns the name votes from the web are cast under. This is the
+// authenticated user, or the hashed ip of the request when anonymous voting
+// is enabled, otherwise it's empty.
+func (q *QuoteDB) webVoter(r *http.Request) string {
+	if q.webauth {
+		return q.authUser(r)
+	}
+
+	if len(q.voterSalt) == 0 {
+		return ""
+	}
+
+	return HashVoter(q.voterSalt, q.clientIP(r))
+}
+
+// csrfToken returns the session's csrf token, creating it if necessary. The
+// cookie is scoped to path.
+func csrfToken(w http.ResponseWriter, r *http.Request, path string) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && len(cookie.Value) != 0 {
+		return cookie.Value, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     path,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+// validCSRF reports whether the csrf token posted with the form matches the
+// one in the request's cookie.
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	return err == nil && len(cookie.Value) != 0 &&
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue("csrf"))) == 1
+}
+
+// href returns an href attribute linking to path under the base path.
+func (q *QuoteDB) href(path string, query url.Values) template.HTMLAttr {
+	link := q.basePath + path
+	if len(query) != 0 {
+		link += "?" + query.Encode()
+	}
+	return template.HTMLAttr(`href="` + template.HTMLEscapeString(link) + `"`)
+}
+
+// queryBool parses a boolean query parameter with strconv.ParseBool so 1,
+// t, TRUE and the like work too. Anything else, including a missing
+// parameter, is false.
+func queryBool(query url.Values, key string) bool {
+	b, _ := strconv.ParseBool(query.Get(key))
+	return b
+}
+
+// queryInt parses a positive integer query parameter, def is used if it's
+// missing or not a positive integer and it's capped at max.
+func queryInt(query url.Values, key string, def, max int) int {
+	n, err := strconv.Atoi(query.Get(key))
+	if err != nil || n < 1 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
 }
 
 func cloneQuery(vals url.Values) url.Values {
@@ -120,7 +823,7 @@ func cloneQuery(vals url.Values) url.Values {
 	for k, v := range vals {
 		vals := make([]string, len(v))
 		copy(vals, v)
-		clone[k] = v
+		clone[k] = vals
 	}
 
 	return clone
@@ -130,6 +833,7 @@ const index = `<!DOCTYPE html>
 <html>
   <head>
     <title>Quotes</title>
+    <link rel="icon" href="{{.Base}}/favicon.ico">
     <link href="https://fonts.googleapis.com/css?family=Lato" rel="stylesheet" type="text/css">
     <style>
     body, html {
@@ -207,6 +911,10 @@ const index = `<!DOCTYPE html>
     table .quote {
     }
 
+    table .quote .source {
+      font-size: 1.1rem;
+    }
+
     table .date {
       width: 140px;
       max-width: 140px;
@@ -227,6 +935,47 @@ const index = `<!DOCTYPE html>
       max-width: 60px;
     }
 
+    tr.pinned td {
+      background-color: rgba(255,255,255,0.05);
+    }
+
+    table .vote {
+      width: 90px;
+      max-width: 90px;
+      white-space: nowrap;
+    }
+
+    table .vote form {
+      display: inline;
+    }
+
+    table .vote button {
+      color: #AAAFB6;
+      background: none;
+      border: solid 1px rgba(255,255,255,0.1);
+      border-radius: 3px;
+      cursor: pointer;
+    }
+
+    table .vote button.active {
+      color: #5F6B7B;
+      background-color: #AAAFB6;
+    }
+
+    .pager {
+      margin-top: 20px;
+      text-align: center;
+      font-size: 1.4rem;
+    }
+
+    .pager a, .pager .current {
+      padding: 0 4px;
+    }
+
+    .pager .current {
+      font-weight: bold;
+    }
+
     .footer {
       margin-top: 20px;
       text-align: center;
@@ -248,23 +997,38 @@ const index = `<!DOCTYPE html>
               <td class="date">Date</td>
               <td class="upvotes">Up</td>
               <td class="downvotes">Down</td>
+              {{if $.Voter}}<td class="vote">Vote</td>{{end}}
             </tr>
           </thead>
           <tbody>
             {{range .Quotes}}
-            <tr>
-              <td class="id">{{.ID}}</td>
+            <tr{{if .Pinned}} class="pinned"{{end}}>
+              <td class="id"><a href="{{$.Base}}/quote/{{.ID}}">{{.ID}}</a></td>
               <td class="votes">{{sub .Upvotes .Downvotes}}</td>
-              <td class="quote">{{range $i, $q := .Quote | splitEm}}{{if not (eq 0 $i)}}<br>{{end}}{{$q}}{{end}}</td>
-              <td class="author">{{.Author}}</td>
+              <td class="quote">{{range $i, $q := .Quote | splitEm}}{{if not (eq 0 $i)}}<br>{{end}}{{if $.Markdown}}{{renderMarkdown $q}}{{else}}{{$q}}{{end}}{{end}}{{if .Source}}<div class="source">{{if isURL .Source}}<a href="{{.Source}}">{{.Source}}</a>{{else}}{{.Source}}{{end}}</div>{{end}}</td>
+              <td class="author"><a href="{{$.Base}}/author/{{pathEscape .Author}}">{{.Author}}</a></td>
               <td class="date">{{fmtDate .Date}}</td>
               <td class="upvotes">{{.Upvotes}}</td>
               <td class="downvotes">{{.Downvotes}}</td>
+              {{if $.Voter}}{{$vote := index $.MyVotes .ID}}
+              <td class="vote">
+                <form method="post" action="{{$.Base}}/quote/{{.ID}}/upvote"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button{{if eq $vote 1}} class="active"{{end}}>+</button></form>
+                <form method="post" action="{{$.Base}}/quote/{{.ID}}/downvote"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button{{if eq $vote -1}} class="active"{{end}}>-</button></form>
+                {{if $vote}}<form method="post" action="{{$.Base}}/quote/{{.ID}}/unvote"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button>x</button></form>{{end}}
+              </td>
+              {{end}}
             </tr>
 			{{end}}
           </tbody>
         </table>
       </div>
+      {{if gt .TotalPages 1}}
+      <div class="pager">
+        {{if .PrevHref}}<a {{.PrevHref}}>&laquo; prev</a>{{end}}
+        {{range .Pages}}{{if .Current}}<span class="current">{{.Number}}</span>{{else}}<a {{.Href}}>{{.Number}}</a>{{end}} {{end}}
+        {{if .NextHref}}<a {{.NextHref}}>next &raquo;</a>{{end}}
+      </div>
+      {{end}}
       {{if .NQuotes}}
       <div class="footer">
         {{.NQuotes}} quotes.
@@ -0,0 +1,176 @@
+package quotes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexEscapesQuotes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		Name   string
+		Author string
+		Quote  string
+		Raw    string
+		Escape string
+	}{
+		{
+			Name:   "script",
+			Author: "mallory",
+			Quote:  "<script>alert(1)</script>",
+			Raw:    "<script>alert(1)",
+			Escape: "&lt;script&gt;alert(1)",
+		},
+		{
+			Name:   "attribute",
+			Author: "mallory",
+			Quote:  `"><img src=x onerror=alert(1)>`,
+			Raw:    "<img src=x onerror",
+			Escape: "&lt;img src=x onerror=alert(1)&gt;",
+		},
+		{
+			Name:   "nick",
+			Author: "mallory",
+			Quote:  `<em onclick="alert(1)">hi</em>`,
+			Raw:    "<em onclick",
+			Escape: "&lt;em onclick=&#34;alert(1)&#34;&gt;hi",
+		},
+		{
+			Name:   "author",
+			Author: "<script>alert(1)</script>",
+			Quote:  "hello",
+			Raw:    "<script>alert(1)",
+			Escape: "&lt;script&gt;alert(1)&lt;/script&gt;",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, markdown := range []bool{false, true} {
+				var options []Option
+				if markdown {
+					options = append(options, WithMarkdown())
+				}
+				q := newTestDB(t, options...)
+				if _, err := q.AddQuote(test.Author, test.Quote); err != nil {
+					t.Fatal(err)
+				}
+
+				rec := httptest.NewRecorder()
+				q.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("markdown %t: status %d", markdown, rec.Code)
+				}
+
+				body := rec.Body.String()
+				if strings.Contains(body, test.Raw) {
+					t.Errorf("markdown %t: page contains %q unescaped", markdown, test.Raw)
+				}
+				if !strings.Contains(body, test.Escape) {
+					t.Errorf("markdown %t: page does not contain %q", markdown, test.Escape)
+				}
+			}
+		})
+	}
+}
+
+func TestCloneQuery(t *testing.T) {
+	t.Parallel()
+
+	in := url.Values{"a": {"1", "2"}, "b": {"3"}}
+	clone := cloneQuery(in)
+
+	clone["a"][0] = "changed"
+	clone.Add("a", "4")
+	clone.Add("b", "5")
+	clone.Set("c", "6")
+
+	want := url.Values{"a": {"1", "2"}, "b": {"3"}}
+	if !reflect.DeepEqual(in, want) {
+		t.Errorf("input changed to %v, want %v", in, want)
+	}
+}
+
+func TestSplitEm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		Name  string
+		Quote string
+		Want  []string
+	}{
+		{
+			Name:  "nicks",
+			Quote: "<bob> hi <alice> hello there",
+			Want:  []string{"<bob> hi ", "<alice> hello there"},
+		},
+		{
+			Name:  "newlines",
+			Quote: "first line\nsecond line\r\n\r\nthird line",
+			Want:  []string{"first line", "second line", "third line"},
+		},
+		{
+			Name:  "nicks on lines",
+			Quote: "<bob> hi\n<alice> hello",
+			Want:  []string{"<bob> hi", "<alice> hello"},
+		},
+		{
+			Name:  "plain",
+			Quote: "just a quote",
+			Want:  []string{"just a quote"},
+		},
+		{
+			Name:  "blank",
+			Quote: "\n\n",
+			Want:  []string{"\n\n"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := splitEm(test.Quote); !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%s: got %q, want %q", test.Name, got, test.Want)
+		}
+	}
+}
+
+func TestDateFormatLocation(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("ACST", 9*60*60+30*60)
+	q := newTestDB(t, WithDateFormat("Jan 2 2006 15:04:05 MST", loc))
+
+	stored := time.Date(2023, time.November, 14, 22, 13, 20, 0, time.UTC)
+	_, err := q.ImportQuotes([]ImportQuote{{Author: "bob", Quote: "hello", Date: stored}}, ImportStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	q.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+
+	// The next day in Adelaide.
+	const want = "Nov 15 2023 07:43:20 ACST"
+	if body := rec.Body.String(); !strings.Contains(body, want) {
+		t.Errorf("page does not show the date as %q:\n%s", want, body)
+	}
+
+	quotes, err := q.GetAll(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quotes) != 1 || !quotes[0].Date.Equal(stored) || quotes[0].Date.Location() != time.UTC {
+		t.Errorf("stored date is %v, want %v", quotes, stored)
+	}
+}